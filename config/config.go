@@ -0,0 +1,321 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/murdinc/MVRD_TX7_PATCHER/generate"
+)
+
+// Config holds the user settings stored in ~/.config/tx7patcher/config.toml.
+type Config struct {
+	Folder    string   `toml:"folder"`
+	Input     string   `toml:"input"`
+	Output    string   `toml:"output"`
+	Thru      string   `toml:"thru"`
+	Channel   int      `toml:"channel"`
+	TestNotes []int    `toml:"test_notes"`
+	Dedup     bool     `toml:"dedup"`
+	Backups   string   `toml:"backups"`
+	Player    string   `toml:"player"`
+	Audition  Audition `toml:"audition"`
+	Mutate    Mutate   `toml:"mutate"`
+	Colors    Colors   `toml:"colors"`
+}
+
+// Audition is the test phrase played on the test notes after an upload. Mode is
+// one of chord, arpeggio, midi, range, velocity or off.
+type Audition struct {
+	Mode     string `toml:"mode"`
+	Velocity int    `toml:"velocity"`
+	Length   int    `toml:"length_ms"`
+	File     string `toml:"file"`
+	Banks    bool   `toml:"banks"`
+}
+
+// Mutate is how the TUI makes variations of a voice. Amount is a percentage, scope
+// one of all, eg, ratios, modulators or lfo.
+type Mutate struct {
+	Amount int    `toml:"amount"`
+	Scope  string `toml:"scope"`
+}
+
+// Colors are termui color names: default, black, red, green, yellow, blue, magenta, cyan or white.
+type Colors struct {
+	Text   string `toml:"text"`
+	Border string `toml:"border"`
+	Label  string `toml:"label"`
+	Items  string `toml:"items"`
+	Scroll string `toml:"scroll"`
+}
+
+// Keys lists the settings the config command can show and set.
+var Keys = []string{
+	"folder", "input", "output", "thru", "channel", "test_notes", "dedup", "backups", "player",
+	"audition.mode", "audition.velocity", "audition.length_ms", "audition.file", "audition.banks",
+	"mutate.amount", "mutate.scope",
+	"colors.text", "colors.border", "colors.label", "colors.items", "colors.scroll",
+}
+
+// Default returns the settings used when there is no config file.
+func Default() Config {
+	return Config{
+		Channel:   1,
+		TestNotes: []int{60, 64, 67},
+		Dedup:     true,
+		Backups:   filepath.Join(filepath.Dir(Path()), "backups"),
+		Audition: Audition{
+			Mode:     "chord",
+			Velocity: 100,
+			Length:   250,
+			Banks:    true,
+		},
+		Mutate: Mutate{
+			Amount: 20,
+			Scope:  "all",
+		},
+		Colors: Colors{
+			Text:   "white",
+			Border: "white",
+			Label:  "cyan",
+			Items:  "yellow",
+			Scroll: "red",
+		},
+	}
+}
+
+// Path returns the location of the config file, honoring $XDG_CONFIG_HOME.
+func Path() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "tx7patcher", "config.toml")
+}
+
+// Load reads the config file, a missing file gives the defaults.
+func Load() (Config, error) {
+	cfg := Default()
+
+	_, err := toml.DecodeFile(Path(), &cfg)
+	if err != nil && !os.IsNotExist(err) {
+		return Default(), fmt.Errorf("reading %s: %s", Path(), err)
+	}
+
+	// The file may have been edited by hand, hold it to what the config command allows
+	for _, key := range checkedKeys {
+		value, _ := cfg.Get(key)
+		if err := cfg.Set(key, value); err != nil {
+			return Default(), fmt.Errorf("reading %s: %s", Path(), err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// checkedKeys are the settings Load checks, the ones with a range or a list of values.
+var checkedKeys = []string{
+	"channel", "audition.mode", "audition.velocity", "audition.length_ms", "mutate.amount", "mutate.scope",
+	"colors.text", "colors.border", "colors.label", "colors.items", "colors.scroll",
+}
+
+// Save writes the config file, creating its folder if needed.
+func (c Config) Save() error {
+	path := Path()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return toml.NewEncoder(f).Encode(c)
+}
+
+// Get returns a setting as text.
+func (c Config) Get(key string) (string, error) {
+	switch key {
+	case "folder":
+		return c.Folder, nil
+	case "input":
+		return c.Input, nil
+	case "output":
+		return c.Output, nil
+	case "thru":
+		return c.Thru, nil
+	case "channel":
+		return strconv.Itoa(c.Channel), nil
+	case "test_notes":
+		notes := make([]string, len(c.TestNotes))
+		for i, note := range c.TestNotes {
+			notes[i] = strconv.Itoa(note)
+		}
+		return strings.Join(notes, ","), nil
+	case "dedup":
+		return strconv.FormatBool(c.Dedup), nil
+	case "backups":
+		return c.Backups, nil
+	case "player":
+		return c.Player, nil
+	case "audition.mode":
+		return c.Audition.Mode, nil
+	case "audition.velocity":
+		return strconv.Itoa(c.Audition.Velocity), nil
+	case "audition.length_ms":
+		return strconv.Itoa(c.Audition.Length), nil
+	case "audition.file":
+		return c.Audition.File, nil
+	case "audition.banks":
+		return strconv.FormatBool(c.Audition.Banks), nil
+	case "mutate.amount":
+		return strconv.Itoa(c.Mutate.Amount), nil
+	case "mutate.scope":
+		return c.Mutate.Scope, nil
+	case "colors.text":
+		return c.Colors.Text, nil
+	case "colors.border":
+		return c.Colors.Border, nil
+	case "colors.label":
+		return c.Colors.Label, nil
+	case "colors.items":
+		return c.Colors.Items, nil
+	case "colors.scroll":
+		return c.Colors.Scroll, nil
+	}
+
+	return "", fmt.Errorf("unknown setting [%s], use one of: %s", key, strings.Join(Keys, ", "))
+}
+
+// Set changes a setting from text, checking that the value makes sense.
+func (c *Config) Set(key string, value string) error {
+	switch key {
+	case "folder":
+		c.Folder = value
+	case "input":
+		c.Input = value
+	case "output":
+		c.Output = value
+	case "thru":
+		c.Thru = value
+	case "channel":
+		channel, err := strconv.Atoi(value)
+		if err != nil || channel < 1 || channel > 16 {
+			return fmt.Errorf("channel must be 1 - 16, got [%s]", value)
+		}
+		c.Channel = channel
+	case "test_notes":
+		notes, err := ParseNotes(value)
+		if err != nil {
+			return err
+		}
+		c.TestNotes = notes
+	case "dedup":
+		dedup, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("dedup must be true or false, got [%s]", value)
+		}
+		c.Dedup = dedup
+	case "backups":
+		if value == "" {
+			return fmt.Errorf("backups needs a folder, bank uploads are always backed up")
+		}
+		c.Backups = value
+	case "player":
+		if value != "" && strings.TrimSpace(value) == "" {
+			return fmt.Errorf("player needs a command, or leave it empty to use the first player found")
+		}
+		c.Player = value
+	case "audition.mode":
+		if !auditionModes[value] {
+			return fmt.Errorf("audition mode must be chord, arpeggio, midi, range, velocity or off, got [%s]", value)
+		}
+		c.Audition.Mode = value
+	case "audition.velocity":
+		velocity, err := strconv.Atoi(value)
+		if err != nil || velocity < 1 || velocity > 127 {
+			return fmt.Errorf("audition velocity must be 1 - 127, got [%s]", value)
+		}
+		c.Audition.Velocity = velocity
+	case "audition.length_ms":
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 10 || length > 10000 {
+			return fmt.Errorf("audition length must be 10 - 10000 ms, got [%s]", value)
+		}
+		c.Audition.Length = length
+	case "audition.file":
+		c.Audition.File = value
+	case "audition.banks":
+		banks, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("audition.banks must be true or false, got [%s]", value)
+		}
+		c.Audition.Banks = banks
+	case "mutate.amount":
+		amount, err := strconv.Atoi(value)
+		if err != nil || amount < 1 || amount > 100 {
+			return fmt.Errorf("mutate amount must be 1 - 100 percent, got [%s]", value)
+		}
+		c.Mutate.Amount = amount
+	case "mutate.scope":
+		if err := generate.CheckScope(value); err != nil {
+			return fmt.Errorf("mutate %s", err)
+		}
+		c.Mutate.Scope = value
+	case "colors.text", "colors.border", "colors.label", "colors.items", "colors.scroll":
+		if _, ok := colorNames[value]; !ok {
+			return fmt.Errorf("unknown color [%s]", value)
+		}
+		switch key {
+		case "colors.text":
+			c.Colors.Text = value
+		case "colors.border":
+			c.Colors.Border = value
+		case "colors.label":
+			c.Colors.Label = value
+		case "colors.items":
+			c.Colors.Items = value
+		case "colors.scroll":
+			c.Colors.Scroll = value
+		}
+	default:
+		return fmt.Errorf("unknown setting [%s], use one of: %s", key, strings.Join(Keys, ", "))
+	}
+
+	return nil
+}
+
+// ParseNotes reads a comma separated list of MIDI notes like "60,64,67", spaces
+// around the notes are ignored.
+func ParseNotes(value string) ([]int, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, fmt.Errorf("notes needs at least one MIDI note 0 - 127, use audition.mode off for no audition")
+	}
+
+	notes := make([]int, 0)
+	for _, field := range strings.Split(value, ",") {
+		note, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || note < 0 || note > 127 {
+			return nil, fmt.Errorf("notes must be a comma separated list of MIDI notes 0 - 127, got [%s]", value)
+		}
+		notes = append(notes, note)
+	}
+	return notes, nil
+}
+
+var auditionModes = map[string]bool{
+	"chord": true, "arpeggio": true, "midi": true, "range": true, "velocity": true, "off": true,
+}
+
+var colorNames = map[string]bool{
+	"default": true, "black": true, "red": true, "green": true, "yellow": true,
+	"blue": true, "magenta": true, "cyan": true, "white": true,
+}
@@ -0,0 +1,195 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+		ok    bool
+		want  string
+	}{
+		{"folder", "/tmp/sysex", true, "/tmp/sysex"},
+		{"input", "", true, ""},
+		{"output", "TX802 Out", true, "TX802 Out"},
+		{"thru", "Keystation", true, "Keystation"},
+
+		{"channel", "1", true, "1"},
+		{"channel", "16", true, "16"},
+		{"channel", "0", false, ""},
+		{"channel", "17", false, ""},
+		{"channel", "one", false, ""},
+
+		{"test_notes", "60,64,67", true, "60,64,67"},
+		{"test_notes", " 0, 127 ", true, "0,127"},
+		{"test_notes", "128", false, ""},
+		{"test_notes", "-1", false, ""},
+		{"test_notes", "", false, ""},
+		{"test_notes", "60,,64", false, ""},
+
+		{"dedup", "false", true, "false"},
+		{"dedup", "yes", false, ""},
+
+		{"backups", "/tmp/backups", true, "/tmp/backups"},
+		{"backups", "", false, ""},
+
+		{"player", "aplay -q", true, "aplay -q"},
+		{"player", "", true, ""},
+		{"player", "  ", false, ""},
+
+		{"audition.mode", "arpeggio", true, "arpeggio"},
+		{"audition.mode", "off", true, "off"},
+		{"audition.mode", "loud", false, ""},
+
+		{"audition.velocity", "1", true, "1"},
+		{"audition.velocity", "127", true, "127"},
+		{"audition.velocity", "0", false, ""},
+		{"audition.velocity", "128", false, ""},
+
+		{"audition.length_ms", "10", true, "10"},
+		{"audition.length_ms", "10000", true, "10000"},
+		{"audition.length_ms", "9", false, ""},
+		{"audition.length_ms", "10001", false, ""},
+
+		{"audition.file", "phrase.mid", true, "phrase.mid"},
+		{"audition.banks", "false", true, "false"},
+		{"audition.banks", "2", false, ""},
+
+		{"mutate.amount", "1", true, "1"},
+		{"mutate.amount", "100", true, "100"},
+		{"mutate.amount", "0", false, ""},
+		{"mutate.amount", "101", false, ""},
+
+		{"mutate.scope", "eg", true, "eg"},
+		{"mutate.scope", "lfo", true, "lfo"},
+		{"mutate.scope", "everything", false, ""},
+
+		{"colors.text", "green", true, "green"},
+		{"colors.border", "default", true, "default"},
+		{"colors.label", "blue", true, "blue"},
+		{"colors.items", "magenta", true, "magenta"},
+		{"colors.scroll", "black", true, "black"},
+		{"colors.text", "orange", false, ""},
+
+		{"volume", "11", false, ""},
+	}
+
+	for _, test := range tests {
+		cfg := Default()
+		before := cfg
+
+		err := cfg.Set(test.key, test.value)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("Set(%q, %q) gave no error", test.key, test.value)
+			}
+			if !reflect.DeepEqual(cfg, before) {
+				t.Errorf("Set(%q, %q) changed the config on error", test.key, test.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Set(%q, %q): %s", test.key, test.value, err)
+			continue
+		}
+
+		got, err := cfg.Get(test.key)
+		if err != nil {
+			t.Errorf("Get(%q): %s", test.key, err)
+		} else if got != test.want {
+			t.Errorf("Set(%q, %q) then Get gave %q, want %q", test.key, test.value, got, test.want)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	cfg := Default()
+	for _, key := range Keys {
+		if _, err := cfg.Get(key); err != nil {
+			t.Errorf("Get(%q): %s", key, err)
+		}
+	}
+}
+
+func TestParseNotes(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []int
+	}{
+		{"60,64,67", []int{60, 64, 67}},
+		{"60, 64 , 67", []int{60, 64, 67}},
+		{" 72 ", []int{72}},
+		{"0,127", []int{0, 127}},
+		{"", nil},
+		{"   ", nil},
+		{"60,", nil},
+		{"60 64", nil},
+		{"-1", nil},
+		{"128", nil},
+		{"C4", nil},
+	}
+
+	for _, test := range tests {
+		got, err := ParseNotes(test.value)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("ParseNotes(%q) = %v, want an error", test.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseNotes(%q): %s", test.value, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseNotes(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	// No file gives the defaults
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("with no config file Load gave %+v", cfg)
+	}
+
+	cfg.Channel = 5
+	cfg.Mutate = Mutate{Amount: 40, Scope: "eg"}
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, cfg) {
+		t.Errorf("Load gave %+v, saved %+v", loaded, cfg)
+	}
+
+	for _, bad := range []Config{
+		func() Config { c := cfg; c.Mutate.Scope = "everything"; return c }(),
+		func() Config { c := cfg; c.Mutate.Amount = 0; return c }(),
+		func() Config { c := cfg; c.Mutate.Amount = 150; return c }(),
+		func() Config { c := cfg; c.Channel = 17; return c }(),
+		func() Config { c := cfg; c.Audition.Mode = "loud"; return c }(),
+		func() Config { c := cfg; c.Colors.Text = "orange"; return c }(),
+	} {
+		if err := bad.Save(); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := Load()
+		if err == nil {
+			t.Errorf("loading %+v gave no error", bad)
+		}
+		if !reflect.DeepEqual(loaded, Default()) {
+			t.Errorf("a bad config file loaded as %+v, want the defaults", loaded)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package fourop
+
+import (
+	"math"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// Algorithms holds the 8 four operator algorithms at index 0 - 7, in the same form
+// as the DX7's. OP4 always has the feedback.
+var Algorithms = [8]parse.Algorithm{
+	{Modulators: [6][]int{{2}, {3}, {4}, nil}, Carriers: []int{1}, Feedback: 4, FeedbackTo: 4},
+	{Modulators: [6][]int{{2}, {3, 4}, nil, nil}, Carriers: []int{1}, Feedback: 4, FeedbackTo: 4},
+	{Modulators: [6][]int{{2, 4}, {3}, nil, nil}, Carriers: []int{1}, Feedback: 4, FeedbackTo: 4},
+	{Modulators: [6][]int{{2, 3}, nil, {4}, nil}, Carriers: []int{1}, Feedback: 4, FeedbackTo: 4},
+	{Modulators: [6][]int{{2}, nil, {4}, nil}, Carriers: []int{1, 3}, Feedback: 4, FeedbackTo: 4},
+	{Modulators: [6][]int{{4}, {4}, {4}, nil}, Carriers: []int{1, 2, 3}, Feedback: 4, FeedbackTo: 4},
+	{Modulators: [6][]int{nil, nil, {4}, nil}, Carriers: []int{1, 2, 3}, Feedback: 4, FeedbackTo: 4},
+	{Modulators: [6][]int{nil, nil, nil, nil}, Carriers: []int{1, 2, 3, 4}, Feedback: 4, FeedbackTo: 4},
+}
+
+// Ratios are the 64 frequency ratios an operator can be set to.
+var Ratios = [64]float64{
+	0.50, 0.71, 0.78, 0.87, 1.00, 1.41, 1.57, 1.73, 2.00, 2.82, 3.00, 3.14, 3.46, 4.00, 4.24, 4.71,
+	5.00, 5.19, 5.65, 6.00, 6.28, 6.92, 7.00, 7.07, 7.85, 8.00, 8.48, 8.65, 9.00, 9.42, 9.89, 10.00,
+	10.38, 10.99, 11.00, 11.30, 12.00, 12.11, 12.56, 12.72, 13.00, 13.84, 14.00, 14.10, 14.13, 15.00, 15.55, 15.57,
+	15.70, 16.96, 17.27, 17.30, 18.37, 18.84, 19.03, 19.78, 20.41, 20.76, 21.20, 21.98, 22.49, 23.55, 24.22, 25.95,
+}
+
+// nearestRatio returns the Ratios index closest to ratio, in pitch.
+func nearestRatio(ratio float64) byte {
+	best, distance := 0, math.Inf(1)
+	for i, r := range Ratios {
+		if d := math.Abs(math.Log2(r / ratio)); d < distance {
+			best, distance = i, d
+		}
+	}
+	return byte(best)
+}
+
+// modulates tells if operator from modulates operator to.
+func modulates(a parse.Algorithm, from int, to int) bool {
+	for _, m := range a.Modulators[to-1] {
+		if m == from {
+			return true
+		}
+	}
+	return false
+}
+
+// permutations calls fn with every ordered pick of k out of the numbers 1 - n.
+func permutations(n int, k int, fn func([]int)) {
+	pick := make([]int, 0, k)
+	used := make([]bool, n+1)
+
+	var next func()
+	next = func() {
+		if len(pick) == k {
+			fn(pick)
+			return
+		}
+		for i := 1; i <= n; i++ {
+			if !used[i] {
+				used[i] = true
+				pick = append(pick, i)
+				next()
+				pick = pick[:len(pick)-1]
+				used[i] = false
+			}
+		}
+	}
+	next()
+}
+
+// match scores how well four operators placed in a six operator algorithm keep the
+// connections of a four operator algorithm. ops[i] is where OP(i+1) went.
+func match(four parse.Algorithm, six parse.Algorithm, ops []int) int {
+	score := 0
+	for to := 1; to <= 4; to++ {
+		if four.IsCarrier(to) == six.IsCarrier(ops[to-1]) {
+			score += 3
+		} else {
+			score -= 3
+		}
+		for from := 1; from <= 4; from++ {
+			if from == to {
+				continue
+			}
+			f, s := modulates(four, from, to), modulates(six, ops[from-1], ops[to-1])
+			if f && s {
+				score += 2
+			} else if f != s {
+				score -= 2
+			}
+		}
+	}
+	if six.Feedback == ops[3] && six.FeedbackTo == ops[3] {
+		score++
+	}
+	return score
+}
+
+// perfect is the score of a placement that keeps every connection and the feedback.
+func perfect(four parse.Algorithm) int {
+	edges := 0
+	for _, modulators := range four.Modulators {
+		edges += len(modulators)
+	}
+	return 4*3 + edges*2 + 1
+}
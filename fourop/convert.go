@@ -0,0 +1,365 @@
+package fourop
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// FromDX7 squeezes a DX7 voice into four operators. The carriers and the modulators
+// that feed them are kept, loudest first, and placed in the four operator algorithm
+// that keeps most of their connections. Everything that didn't survive is listed.
+func FromDX7(dx7 parse.Voice) (Voice, []string) {
+	var lost []string
+	v := InitVoice()
+	v.Name = dx7.Name
+
+	if len(dx7.Operators) != 6 {
+		return v, []string{"the voice has no operators"}
+	}
+
+	six := dx7.Topology()
+	kept := significant(dx7, six)
+
+	// Try every four operator algorithm and every order of the kept operators
+	best, bestScore, bestOps := 0, math.MinInt, []int(nil)
+	for alg, four := range Algorithms {
+		permutations(4, 4, func(order []int) {
+			ops := make([]int, 4)
+			for i, o := range order {
+				ops[i] = kept[o-1]
+			}
+			// Ties keep the operators in their DX7 order
+			score := match(four, six, ops)
+			if score > bestScore || score == bestScore && alg == best && lower(ops, bestOps) {
+				best, bestScore, bestOps = alg, score, ops
+			}
+		})
+	}
+
+	// Missing only the feedback point is reported with the feedback below
+	v.Algorithm = byte(best)
+	if bestScore < perfect(Algorithms[best])-1 {
+		lost = append(lost, fmt.Sprintf("algorithm %d has no four operator match, using algorithm %d", dx7.Algorithm+1, best+1))
+	}
+
+	for op := 1; op <= 6; op++ {
+		if !contains(bestOps, op) && dx7.Operator(op).OutputLevel > 0 {
+			lost = append(lost, fmt.Sprintf("OP%d dropped (output level %d)", op, dx7.Operator(op).OutputLevel))
+		}
+	}
+
+	// Only OP4 has feedback
+	if dx7.Feedback > 0 {
+		if six.Feedback == bestOps[3] && six.FeedbackTo == bestOps[3] {
+			v.Feedback = dx7.Feedback
+		} else {
+			lost = append(lost, fmt.Sprintf("feedback %d on OP%d", dx7.Feedback, six.Feedback))
+		}
+	}
+
+	for i, op := range bestOps {
+		o, operatorLost := fromDX7Operator(dx7.Operator(op))
+		v.Operators[i] = o
+		for _, l := range operatorLost {
+			lost = append(lost, fmt.Sprintf("OP%d %s", op, l))
+		}
+		if o.AmpModEnable == 1 && dx7.Operator(op).AmplitudeModulationSensitivity > v.AmpModSensitivity {
+			v.AmpModSensitivity = dx7.Operator(op).AmplitudeModulationSensitivity
+		}
+	}
+	for _, op := range bestOps {
+		if ams := dx7.Operator(op).AmplitudeModulationSensitivity; ams > 0 && ams != v.AmpModSensitivity {
+			lost = append(lost, fmt.Sprintf("OP%d amp mod sensitivity %d, all operators share %d", op, ams, v.AmpModSensitivity))
+		}
+	}
+
+	v.LfoSpeed, v.LfoDelay = dx7.LfoSpeed, dx7.LfoDelay
+	v.LfoPitchModDepth, v.LfoAMDepth = dx7.LfoPitchModDepth, dx7.LfoAMDepth
+	v.LfoSync = dx7.LfoSync
+	v.PitchModSensitivity = dx7.LfoPitchModSensitivity
+	v.Transpose = dx7.Transpose
+
+	switch dx7.LfoWave {
+	case 0, 4: // triangle, sine
+		v.LfoWave = 2
+	case 1, 2: // saw down, saw up
+		v.LfoWave = 0
+	case 3:
+		v.LfoWave = 1
+	default:
+		v.LfoWave = 3
+	}
+	if dx7.LfoWave == 1 || dx7.LfoWave == 4 {
+		lost = append(lost, fmt.Sprintf("LFO wave %s, using %s", parse.LfoWaves[dx7.LfoWave], lfoWaves[v.LfoWave]))
+	}
+
+	v.PitchEGRates = [3]byte{dx7.PitchEGRate1, dx7.PitchEGRate2, dx7.PitchEGRate3}
+	v.PitchEGLevels = [3]byte{dx7.PitchEGLevel1, dx7.PitchEGLevel2, dx7.PitchEGLevel3}
+	for _, level := range []byte{dx7.PitchEGLevel1, dx7.PitchEGLevel2, dx7.PitchEGLevel3, dx7.PitchEGLevel4} {
+		if level != 50 {
+			lost = append(lost, "pitch EG, only the DX21 plays it")
+			break
+		}
+	}
+	if dx7.PitchEGLevel4 != 50 {
+		lost = append(lost, fmt.Sprintf("pitch EG level 4 (%d)", dx7.PitchEGLevel4))
+	}
+
+	return v, lost
+}
+
+// ToDX7 places a four operator voice in the DX7 algorithm with the same connections,
+// the two operators left over are silent. Everything that didn't survive is listed.
+func ToDX7(v Voice) (parse.Voice, []string) {
+	var lost []string
+	dx7 := parse.InitVoice()
+	dx7.Name = v.Name
+
+	alg, ops := dx7Layout(int(v.Algorithm & 0x7))
+	dx7.Algorithm = byte(alg)
+	six := parse.Algorithms[alg]
+
+	for op := 1; op <= 6; op++ {
+		o := parse.Operator{
+			EGRate1: 99, EGRate2: 99, EGRate3: 99, EGRate4: 99, EGLevel1: 99, EGLevel2: 99, EGLevel3: 99,
+			LevelScalingBreakPoint: 39, Detune: 7, FrequencyCoarse: 1,
+		}
+		for i, placed := range ops {
+			if placed == op {
+				o = toDX7Operator(v.Operator(i+1), v.AmpModSensitivity)
+			}
+		}
+		dx7.Operators[6-op] = o
+	}
+
+	if v.Feedback > 0 && six.Feedback == ops[3] {
+		dx7.Feedback = v.Feedback
+	}
+
+	dx7.LfoSpeed, dx7.LfoDelay = v.LfoSpeed, v.LfoDelay
+	dx7.LfoPitchModDepth, dx7.LfoAMDepth = v.LfoPitchModDepth, v.LfoAMDepth
+	dx7.LfoSync = v.LfoSync
+	dx7.LfoPitchModSensitivity = v.PitchModSensitivity
+	dx7.LfoWave = [4]byte{2, 3, 0, 5}[v.LfoWave&0x3]
+	dx7.Transpose = v.Transpose
+
+	dx7.PitchEGRate1, dx7.PitchEGRate2, dx7.PitchEGRate3 = v.PitchEGRates[0], v.PitchEGRates[1], v.PitchEGRates[2]
+	dx7.PitchEGLevel1, dx7.PitchEGLevel2, dx7.PitchEGLevel3 = v.PitchEGLevels[0], v.PitchEGLevels[1], v.PitchEGLevels[2]
+	dx7.PitchEGLevel4 = 50
+
+	for op := 1; op <= 4; op++ {
+		if ebs := v.Operator(op).EGBiasSensitivity; ebs > 0 {
+			lost = append(lost, fmt.Sprintf("OP%d EG bias sensitivity %d", op, ebs))
+		}
+	}
+	if v.Mono == 1 || v.Portamento == 1 || v.PortamentoTime > 0 || v.BreathPitch > 0 || v.BreathAmp > 0 || v.BreathEGBias > 0 {
+		lost = append(lost, "mono, portamento and breath control, they are not part of a DX7 voice")
+	}
+
+	return dx7, lost
+}
+
+var lfoWaves = [4]string{"saw_up", "square", "triangle", "sample_hold"}
+
+// significant picks the four operators that matter most: the carriers, then the
+// modulators feeding what was already picked, loudest first.
+func significant(dx7 parse.Voice, six parse.Algorithm) []int {
+	level := func(op int) int {
+		return int(dx7.Operator(op).OutputLevel)
+	}
+
+	ranked := []int{1, 2, 3, 4, 5, 6}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if (level(a) > 0) != (level(b) > 0) {
+			return level(a) > 0
+		}
+		if six.IsCarrier(a) != six.IsCarrier(b) {
+			return six.IsCarrier(a)
+		}
+		return level(a) > level(b)
+	})
+
+	var kept []int
+	for _, op := range ranked {
+		if six.IsCarrier(op) && level(op) > 0 && len(kept) < 4 {
+			kept = append(kept, op)
+		}
+	}
+
+	// Modulators feeding what was kept come first, even silent ones keep the shape
+	for len(kept) < 4 {
+		next, priority := 0, -1
+		for _, op := range ranked {
+			if contains(kept, op) {
+				continue
+			}
+			p := 0
+			for _, k := range kept {
+				if modulates(six, op, k) {
+					p = 2
+				}
+			}
+			if level(op) > 0 {
+				p++
+			}
+			if p > priority {
+				next, priority = op, p
+			}
+		}
+		kept = append(kept, next)
+	}
+
+	return kept
+}
+
+func fromDX7Operator(o parse.Operator) (Operator, []string) {
+	var lost []string
+
+	f := Operator{
+		AttackRate:             scale(o.EGRate1, 99, 31),
+		Decay1Rate:             scale(o.EGRate2, 99, 31),
+		ReleaseRate:            scale(o.EGRate4, 99, 15),
+		OutputLevel:            o.OutputLevel,
+		KeyVelocitySensitivity: o.KeyVelocitySensitivity,
+		RateScaling:            scale(o.RateScale, 7, 3),
+	}
+	if f.ReleaseRate < 1 {
+		f.ReleaseRate = 1
+	}
+
+	// The four operator EG always attacks to full level, decays to D1L and from
+	// there either holds or keeps decaying to silence
+	if o.EGLevel3 > 0 {
+		f.Decay1Level = scale(o.EGLevel3, 99, 15)
+		if diff := int(o.EGLevel2) - int(o.EGLevel3); diff > 10 || diff < -10 {
+			lost = append(lost, fmt.Sprintf("EG level 2 (%d)", o.EGLevel2))
+		}
+	} else {
+		f.Decay1Level = scale(o.EGLevel2, 99, 15)
+		f.Decay2Rate = scale(o.EGRate3, 99, 31)
+	}
+	if o.EGLevel1 < 90 {
+		lost = append(lost, fmt.Sprintf("EG level 1 (%d)", o.EGLevel1))
+	}
+	if o.EGLevel4 > 0 {
+		lost = append(lost, fmt.Sprintf("EG level 4 (%d)", o.EGLevel4))
+	}
+
+	if o.AmplitudeModulationSensitivity > 0 {
+		f.AmpModEnable = 1
+	}
+
+	f.Detune = byte(math.Round((float64(o.Detune)-7)*3/7) + 3)
+
+	ratio := float64(o.FrequencyCoarse)
+	if ratio == 0 {
+		ratio = 0.5
+	}
+	ratio *= 1 + float64(o.FrequencyFine)/100
+	f.Frequency = nearestRatio(ratio)
+	if o.OscillatorMode == 1 {
+		lost = append(lost, "fixed frequency, using the nearest ratio")
+	} else if got := Ratios[f.Frequency]; math.Abs(math.Log2(got/ratio)) > 0.01 {
+		lost = append(lost, fmt.Sprintf("ratio %.2f became %.2f", ratio, got))
+	}
+
+	// Level scaling only pulls the level down going up the keyboard
+	if o.ScaleRightCurve < 2 {
+		f.LevelScaling = o.ScaleRightDepth
+	}
+	if o.ScaleLeftDepth > 0 || (o.ScaleRightCurve >= 2 && o.ScaleRightDepth > 0) {
+		lost = append(lost, "keyboard level scaling, only a falling right curve is kept")
+	}
+
+	return f, lost
+}
+
+func toDX7Operator(f Operator, ams byte) parse.Operator {
+	o := parse.Operator{
+		EGRate1:                scale(f.AttackRate, 31, 99),
+		EGRate2:                scale(f.Decay1Rate, 31, 99),
+		EGRate3:                scale(f.Decay2Rate, 31, 99),
+		EGRate4:                scale(f.ReleaseRate, 15, 99),
+		EGLevel1:               99,
+		EGLevel2:               scale(f.Decay1Level, 15, 99),
+		OutputLevel:            f.OutputLevel,
+		KeyVelocitySensitivity: f.KeyVelocitySensitivity,
+		RateScale:              scale(f.RateScaling, 3, 7),
+		Detune:                 byte((int(f.Detune&0x7)-3)*7/3 + 7),
+		LevelScalingBreakPoint: 0,
+		ScaleRightDepth:        f.LevelScaling,
+		ScaleRightCurve:        0, // -lin
+	}
+
+	o.EGLevel3 = o.EGLevel2
+	if f.Decay2Rate > 0 {
+		o.EGLevel3 = 0
+	}
+
+	if f.AmpModEnable == 1 {
+		o.AmplitudeModulationSensitivity = ams
+	}
+
+	ratio := Ratios[f.Frequency&0x3F]
+	if ratio < 1 {
+		o.FrequencyCoarse = 0
+		o.FrequencyFine = byte(math.Round((ratio/0.5 - 1) * 100))
+	} else {
+		coarse := math.Floor(ratio)
+		o.FrequencyCoarse = byte(coarse)
+		o.FrequencyFine = byte(math.Min(99, math.Round((ratio/coarse-1)*100)))
+	}
+
+	return o
+}
+
+// dx7Layout finds the DX7 algorithm that has a four operator algorithm inside it,
+// and where OP1 - OP4 go in it.
+func dx7Layout(alg int) (int, []int) {
+	four := Algorithms[alg]
+	for six := range parse.Algorithms {
+		var found []int
+		permutations(6, 4, func(ops []int) {
+			if found == nil && match(four, parse.Algorithms[six], ops) == perfect(four) {
+				found = append([]int{}, ops...)
+			}
+		})
+		if found != nil {
+			return six, found
+		}
+	}
+
+	// Every four operator algorithm has a match, this is never reached
+	return 0, []int{1, 2, 3, 4}
+}
+
+// scale moves a value from the range 0 - from to 0 - to.
+func scale(value byte, from int, to int) byte {
+	if int(value) > from {
+		value = byte(from)
+	}
+	return byte(math.Round(float64(value) * float64(to) / float64(from)))
+}
+
+// lower tells if a comes before b, comparing operator by operator.
+func lower(a []int, b []int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+func contains(ops []int, op int) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
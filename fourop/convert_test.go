@@ -0,0 +1,87 @@
+package fourop
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// representable is a four operator voice that a DX7 can hold exactly: no EG bias,
+// breath control or mono, and every operator audible so none is dropped.
+func representable(algorithm byte) Voice {
+	v := InitVoice()
+	v.Name = "FOUR OP"
+	v.Algorithm = algorithm
+	v.Feedback = 5
+	v.LfoSpeed, v.LfoDelay, v.LfoPitchModDepth, v.LfoAMDepth = 40, 10, 20, 30
+	v.LfoWave = 3
+	v.PitchModSensitivity = 4
+	v.AmpModSensitivity = 2
+	v.Transpose = 26
+
+	for i := range v.Operators {
+		n := byte(i)
+		v.Operators[i] = Operator{
+			AttackRate: 31 - n, Decay1Rate: 20 + n, Decay2Rate: 4 * (n % 2), ReleaseRate: 8 + n, Decay1Level: 10 + n,
+			LevelScaling: 10 * n, RateScaling: n, AmpModEnable: n % 2, KeyVelocitySensitivity: n,
+			OutputLevel: 99 - n, Frequency: [4]byte{4, 5, 11, 0}[i], Detune: 2 * n,
+		}
+	}
+
+	return v
+}
+
+// Each four operator algorithm sits in its own DX7 algorithm, a DX7 voice built that
+// way has to come back from four operators unchanged and without losses.
+func TestDX7RoundTrip(t *testing.T) {
+	for alg := byte(0); alg < 8; alg++ {
+		dx7, lost := ToDX7(representable(alg))
+		if len(lost) > 0 {
+			t.Errorf("algorithm %d: ToDX7 lost %v", alg+1, lost)
+		}
+
+		four, lost := FromDX7(dx7)
+		if len(lost) > 0 {
+			t.Errorf("algorithm %d: FromDX7 of DX7 algorithm %d lost %v", alg+1, dx7.Algorithm+1, lost)
+		}
+		if four.Algorithm != alg {
+			t.Errorf("algorithm %d: came back as algorithm %d", alg+1, four.Algorithm+1)
+		}
+
+		again, _ := ToDX7(four)
+		if !bytes.Equal(again.Unpacked(), dx7.Unpacked()) {
+			t.Errorf("algorithm %d: ToDX7(FromDX7(v)) changed the voice:\n got %v\nwant %v", alg+1, again.Unpacked(), dx7.Unpacked())
+		}
+	}
+}
+
+func TestFromDX7Lost(t *testing.T) {
+	dx7 := parse.InitVoice()
+	dx7.Algorithm = 31 // six carriers, feedback on OP6
+	dx7.Feedback = 7
+	for op := 1; op <= 6; op++ {
+		dx7.Operators[6-op].OutputLevel = byte(100 - op)
+	}
+	dx7.Operators[6-2].OscillatorMode = 1 // OP2 fixed
+
+	v, lost := FromDX7(dx7)
+
+	expect := []string{
+		"OP5 dropped (output level 95)",
+		"OP6 dropped (output level 94)",
+		"feedback 7 on OP6",
+		"OP2 fixed frequency, using the nearest ratio",
+	}
+	if !reflect.DeepEqual(lost, expect) {
+		t.Errorf("lost %q, expected %q", lost, expect)
+	}
+
+	if v.Algorithm != 7 {
+		t.Errorf("six carriers became algorithm %d, expected 8", v.Algorithm+1)
+	}
+	if v.Feedback != 0 {
+		t.Errorf("feedback %d survived without its operator", v.Feedback)
+	}
+}
@@ -0,0 +1,308 @@
+// Package fourop reads and writes voices for Yamaha's four operator FM synths, the
+// DX21, DX27, DX100 and TX81Z, and converts them to and from DX7 voices.
+//
+// Only the common voice data (VCED and VMEM) is handled. The TX81Z keeps its extra
+// waveforms and fixed frequencies in a separate ACED message, which is skipped.
+package fourop
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// Sysex formats of the four operator voice dumps.
+const (
+	FormatVCED = 0x03 // single voice
+	FormatVMEM = 0x04 // 32 voice bank
+
+	VoiceDumpSize = 101
+	BankDumpSize  = 4104
+)
+
+// sysexOrder is the order the operators are stored in, OP4 first.
+var sysexOrder = [4]int{4, 2, 3, 1}
+
+// Operator holds the settings of one of the four operators.
+type Operator struct {
+	AttackRate             byte // 0 - 31
+	Decay1Rate             byte // 0 - 31
+	Decay2Rate             byte // 0 - 31
+	ReleaseRate            byte // 1 - 15
+	Decay1Level            byte // 0 - 15
+	LevelScaling           byte // 0 - 99
+	RateScaling            byte // 0 - 3
+	EGBiasSensitivity      byte // 0 - 7
+	AmpModEnable           byte // 0 - 1
+	KeyVelocitySensitivity byte // 0 - 7
+	OutputLevel            byte // 0 - 99
+	Frequency              byte // 0 - 63, an index into Ratios
+	Detune                 byte // 0 - 6, 3 is centered
+}
+
+// Voice is a four operator voice.
+type Voice struct {
+	Operators [4]Operator // OP1 - OP4
+
+	Algorithm           byte // 0 - 7
+	Feedback            byte // 0 - 7
+	LfoSpeed            byte
+	LfoDelay            byte
+	LfoPitchModDepth    byte
+	LfoAMDepth          byte
+	LfoSync             byte
+	LfoWave             byte // saw up, square, triangle, sample & hold
+	PitchModSensitivity byte // 0 - 7
+	AmpModSensitivity   byte // 0 - 3
+	Transpose           byte // 0 - 48, 24 is C3
+
+	Mono            byte
+	PitchBendRange  byte
+	PortamentoMode  byte
+	PortamentoTime  byte
+	FootVolume      byte
+	Sustain         byte
+	Portamento      byte
+	Chorus          byte
+	ModWheelPitch   byte
+	ModWheelAmp     byte
+	BreathPitch     byte
+	BreathAmp       byte
+	BreathPitchBias byte
+	BreathEGBias    byte
+
+	Name string
+
+	// The pitch EG only exists on the DX21
+	PitchEGRates  [3]byte
+	PitchEGLevels [3]byte
+}
+
+// Operator returns operator 1 - 4.
+func (v Voice) Operator(op int) Operator {
+	return v.Operators[op-1]
+}
+
+// InitVoice returns the four operator init voice, a single sine on OP1.
+func InitVoice() Voice {
+	voice := Voice{
+		LfoSpeed:       35,
+		Transpose:      24,
+		PitchBendRange: 4,
+		ModWheelPitch:  50,
+		Name:           "INIT VOICE",
+		PitchEGRates:   [3]byte{99, 99, 99},
+		PitchEGLevels:  [3]byte{50, 50, 50},
+	}
+
+	for i := range voice.Operators {
+		voice.Operators[i] = Operator{AttackRate: 31, Decay1Rate: 31, ReleaseRate: 15, Decay1Level: 15, Frequency: 4, Detune: 3}
+	}
+	voice.Operators[0].OutputLevel = 90
+
+	return voice
+}
+
+// Parse reads every four operator voice in a sysex file. A TX81Z sends an ACED
+// message ahead of each voice, that and anything else that isn't VCED or VMEM is skipped.
+func Parse(data []byte) ([]Voice, error) {
+	var voices []Voice
+
+	for len(data) > 0 {
+		start := bytes.IndexByte(data, 0xF0)
+		if start < 0 {
+			break
+		}
+		end := bytes.IndexByte(data[start:], 0xF7)
+		if end < 0 {
+			break
+		}
+		message := data[start : start+end+1]
+		data = data[start+end+1:]
+
+		if len(message) < 8 || message[1] != 0x43 {
+			continue
+		}
+		payload := message[6 : len(message)-2]
+		if parse.Checksum(payload) != message[len(message)-2] {
+			return nil, fmt.Errorf("bad checksum in a format %d dump", message[3])
+		}
+
+		switch message[3] {
+		case FormatVCED:
+			if len(payload) != 93 {
+				return nil, fmt.Errorf("single voice dump has %d bytes, expected 93", len(payload))
+			}
+			voices = append(voices, unpacked(payload))
+
+		case FormatVMEM:
+			if len(payload) != 4096 {
+				return nil, fmt.Errorf("bank dump has %d bytes, expected 4096", len(payload))
+			}
+			for i := 0; i < 32; i++ {
+				voices = append(voices, packed(payload[i*128:(i+1)*128]))
+			}
+		}
+	}
+
+	if len(voices) == 0 {
+		return nil, errors.New("no four operator voices found")
+	}
+
+	return voices, nil
+}
+
+// Unpacked returns the 93 byte single voice (VCED) form of the voice.
+func (v Voice) Unpacked() []byte {
+	data := make([]byte, 0, 93)
+
+	for _, op := range sysexOrder {
+		o := v.Operator(op)
+		data = append(data, o.AttackRate, o.Decay1Rate, o.Decay2Rate, o.ReleaseRate, o.Decay1Level, o.LevelScaling,
+			o.RateScaling, o.EGBiasSensitivity, o.AmpModEnable, o.KeyVelocitySensitivity, o.OutputLevel, o.Frequency, o.Detune)
+	}
+
+	data = append(data, v.Algorithm, v.Feedback, v.LfoSpeed, v.LfoDelay, v.LfoPitchModDepth, v.LfoAMDepth, v.LfoSync,
+		v.LfoWave, v.PitchModSensitivity, v.AmpModSensitivity, v.Transpose, v.Mono, v.PitchBendRange, v.PortamentoMode,
+		v.PortamentoTime, v.FootVolume, v.Sustain, v.Portamento, v.Chorus, v.ModWheelPitch, v.ModWheelAmp,
+		v.BreathPitch, v.BreathAmp, v.BreathPitchBias, v.BreathEGBias)
+
+	data = append(data, name(v.Name)...)
+
+	data = append(data, v.PitchEGRates[:]...)
+	return append(data, v.PitchEGLevels[:]...)
+}
+
+// Packed returns the 128 byte bulk (VMEM) form of the voice, as stored in a 32 voice bank.
+func (v Voice) Packed() []byte {
+	data := make([]byte, 0, 128)
+
+	for _, op := range sysexOrder {
+		o := v.Operator(op)
+		data = append(data, o.AttackRate, o.Decay1Rate, o.Decay2Rate, o.ReleaseRate, o.Decay1Level, o.LevelScaling,
+			(o.AmpModEnable&0x1)<<6|(o.EGBiasSensitivity&0x7)<<3|o.KeyVelocitySensitivity&0x7,
+			o.OutputLevel, o.Frequency,
+			(o.RateScaling&0x3)<<3|o.Detune&0x7)
+	}
+
+	data = append(data,
+		(v.LfoSync&0x1)<<6|(v.Feedback&0x7)<<3|v.Algorithm&0x7,
+		v.LfoSpeed, v.LfoDelay, v.LfoPitchModDepth, v.LfoAMDepth,
+		(v.PitchModSensitivity&0x7)<<4|(v.AmpModSensitivity&0x3)<<2|v.LfoWave&0x3,
+		v.Transpose, v.PitchBendRange,
+		(v.Chorus&0x1)<<4|(v.Mono&0x1)<<3|(v.Sustain&0x1)<<2|(v.Portamento&0x1)<<1|v.PortamentoMode&0x1,
+		v.PortamentoTime, v.FootVolume, v.ModWheelPitch, v.ModWheelAmp,
+		v.BreathPitch, v.BreathAmp, v.BreathPitchBias, v.BreathEGBias)
+
+	data = append(data, name(v.Name)...)
+
+	data = append(data, v.PitchEGRates[:]...)
+	data = append(data, v.PitchEGLevels[:]...)
+
+	// The rest is TX81Z additional data or unused, left at its defaults
+	return append(data, make([]byte, 128-len(data))...)
+}
+
+// VoiceSysex packages a voice as a single voice (VCED) sysex message.
+func VoiceSysex(v Voice) []byte {
+	data := v.Unpacked()
+	sysex := append([]byte{0xF0, 0x43, 0x00, FormatVCED, 0x00, 0x5D}, data...)
+	return append(sysex, parse.Checksum(data), 0xF7)
+}
+
+// BankSysex packages up to 32 voices as a bank (VMEM) sysex message, empty slots get the init voice.
+func BankSysex(voices []Voice) []byte {
+	data := make([]byte, 0, 4096)
+	for i := 0; i < 32; i++ {
+		voice := InitVoice()
+		if i < len(voices) {
+			voice = voices[i]
+		}
+		data = append(data, voice.Packed()...)
+	}
+
+	sysex := append([]byte{0xF0, 0x43, 0x00, FormatVMEM, 0x20, 0x00}, data...)
+	return append(sysex, parse.Checksum(data), 0xF7)
+}
+
+func unpacked(data []byte) Voice {
+	var v Voice
+
+	for i, op := range sysexOrder {
+		d := data[i*13:]
+		v.Operators[op-1] = Operator{
+			AttackRate: d[0], Decay1Rate: d[1], Decay2Rate: d[2], ReleaseRate: d[3], Decay1Level: d[4], LevelScaling: d[5],
+			RateScaling: d[6], EGBiasSensitivity: d[7], AmpModEnable: d[8], KeyVelocitySensitivity: d[9],
+			OutputLevel: d[10], Frequency: d[11], Detune: d[12],
+		}
+	}
+
+	d := data[52:]
+	v.Algorithm, v.Feedback, v.LfoSpeed, v.LfoDelay, v.LfoPitchModDepth, v.LfoAMDepth = d[0], d[1], d[2], d[3], d[4], d[5]
+	v.LfoSync, v.LfoWave, v.PitchModSensitivity, v.AmpModSensitivity, v.Transpose = d[6], d[7], d[8], d[9], d[10]
+	v.Mono, v.PitchBendRange, v.PortamentoMode, v.PortamentoTime, v.FootVolume = d[11], d[12], d[13], d[14], d[15]
+	v.Sustain, v.Portamento, v.Chorus, v.ModWheelPitch, v.ModWheelAmp = d[16], d[17], d[18], d[19], d[20]
+	v.BreathPitch, v.BreathAmp, v.BreathPitchBias, v.BreathEGBias = d[21], d[22], d[23], d[24]
+
+	v.Name = strings.TrimRight(string(data[77:87]), " \x00")
+	copy(v.PitchEGRates[:], data[87:90])
+	copy(v.PitchEGLevels[:], data[90:93])
+
+	return v
+}
+
+func packed(data []byte) Voice {
+	var v Voice
+
+	for i, op := range sysexOrder {
+		d := data[i*10:]
+		v.Operators[op-1] = Operator{
+			AttackRate: d[0], Decay1Rate: d[1], Decay2Rate: d[2], ReleaseRate: d[3], Decay1Level: d[4], LevelScaling: d[5],
+			AmpModEnable:           (d[6] >> 6) & 0x1,
+			EGBiasSensitivity:      (d[6] >> 3) & 0x7,
+			KeyVelocitySensitivity: d[6] & 0x7,
+			OutputLevel:            d[7],
+			Frequency:              d[8],
+			RateScaling:            (d[9] >> 3) & 0x3,
+			Detune:                 d[9] & 0x7,
+		}
+	}
+
+	d := data[40:]
+	v.LfoSync = (d[0] >> 6) & 0x1
+	v.Feedback = (d[0] >> 3) & 0x7
+	v.Algorithm = d[0] & 0x7
+	v.LfoSpeed, v.LfoDelay, v.LfoPitchModDepth, v.LfoAMDepth = d[1], d[2], d[3], d[4]
+	v.PitchModSensitivity = (d[5] >> 4) & 0x7
+	v.AmpModSensitivity = (d[5] >> 2) & 0x3
+	v.LfoWave = d[5] & 0x3
+	v.Transpose, v.PitchBendRange = d[6], d[7]
+	v.Chorus = (d[8] >> 4) & 0x1
+	v.Mono = (d[8] >> 3) & 0x1
+	v.Sustain = (d[8] >> 2) & 0x1
+	v.Portamento = (d[8] >> 1) & 0x1
+	v.PortamentoMode = d[8] & 0x1
+	v.PortamentoTime, v.FootVolume, v.ModWheelPitch, v.ModWheelAmp = d[9], d[10], d[11], d[12]
+	v.BreathPitch, v.BreathAmp, v.BreathPitchBias, v.BreathEGBias = d[13], d[14], d[15], d[16]
+
+	v.Name = strings.TrimRight(string(data[57:67]), " \x00")
+	copy(v.PitchEGRates[:], data[67:70])
+	copy(v.PitchEGLevels[:], data[70:73])
+
+	return v
+}
+
+// name pads or cuts a name to the 10 ASCII characters a voice has room for.
+func name(s string) []byte {
+	if len(s) > 10 {
+		s = s[:10]
+	}
+	data := []byte(s + strings.Repeat(" ", 10-len(s)))
+	for i := range data {
+		data[i] &= 0x7F
+	}
+	return data
+}
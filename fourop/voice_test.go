@@ -0,0 +1,122 @@
+package fourop
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// testVoice sets every field to a different value inside its range, so a field
+// packed into the wrong bits or the wrong operator shows up.
+func testVoice() Voice {
+	v := Voice{
+		Algorithm: 5, Feedback: 6, LfoSpeed: 71, LfoDelay: 12, LfoPitchModDepth: 33, LfoAMDepth: 44,
+		LfoSync: 1, LfoWave: 2, PitchModSensitivity: 5, AmpModSensitivity: 3, Transpose: 30,
+		Mono: 1, PitchBendRange: 7, PortamentoMode: 1, PortamentoTime: 55, FootVolume: 66,
+		Sustain: 1, Portamento: 1, Chorus: 1, ModWheelPitch: 77, ModWheelAmp: 88,
+		BreathPitch: 11, BreathAmp: 22, BreathPitchBias: 60, BreathEGBias: 9,
+		Name:          "ROUND TRIP",
+		PitchEGRates:  [3]byte{10, 20, 30},
+		PitchEGLevels: [3]byte{40, 60, 80},
+	}
+
+	for i := range v.Operators {
+		n := byte(i)
+		v.Operators[i] = Operator{
+			AttackRate: 20 + n, Decay1Rate: 10 + n, Decay2Rate: 5 + n, ReleaseRate: 11 + n, Decay1Level: 12 - n,
+			LevelScaling: 50 + n, RateScaling: n, EGBiasSensitivity: 7 - n, AmpModEnable: n % 2,
+			KeyVelocitySensitivity: 3 + n, OutputLevel: 90 + n, Frequency: 60 - n, Detune: 6 - n,
+		}
+	}
+
+	return v
+}
+
+func TestUnpackedRoundTrip(t *testing.T) {
+	v := testVoice()
+
+	data := v.Unpacked()
+	if len(data) != 93 {
+		t.Fatalf("VCED is %d bytes, expected 93", len(data))
+	}
+	if got := unpacked(data); !reflect.DeepEqual(got, v) {
+		t.Errorf("VCED round trip changed the voice:\n got %+v\nwant %+v", got, v)
+	}
+}
+
+func TestPackedRoundTrip(t *testing.T) {
+	v := testVoice()
+
+	data := v.Packed()
+	if len(data) != 128 {
+		t.Fatalf("VMEM is %d bytes, expected 128", len(data))
+	}
+	if got := packed(data); !reflect.DeepEqual(got, v) {
+		t.Errorf("VMEM round trip changed the voice:\n got %+v\nwant %+v", got, v)
+	}
+
+	// Spot check the bit fields against the VMEM layout
+	bits := []struct {
+		name   string
+		index  int
+		expect byte
+	}{
+		{"OP4 AME, EBS and KVS", 6, 1<<6 | 4<<3 | 6},
+		{"OP4 RS and DET", 9, 3<<3 | 3},
+		{"sync, feedback and algorithm", 40, 1<<6 | 6<<3 | 5},
+		{"PMS, AMS and wave", 45, 5<<4 | 3<<2 | 2},
+		{"chorus, mono, sustain, portamento and mode", 48, 0x1F},
+	}
+	for _, b := range bits {
+		if data[b.index] != b.expect {
+			t.Errorf("%s: byte %d is %08b, expected %08b", b.name, b.index, data[b.index], b.expect)
+		}
+	}
+}
+
+func TestSysexOrder(t *testing.T) {
+	v := testVoice()
+	unpackedData, packedData := v.Unpacked(), v.Packed()
+
+	// OP4, OP2, OP3, OP1
+	for i, op := range []int{4, 2, 3, 1} {
+		if got, expect := unpackedData[i*13], v.Operator(op).AttackRate; got != expect {
+			t.Errorf("VCED operator block %d has attack rate %d, expected OP%d's %d", i, got, op, expect)
+		}
+		if got, expect := packedData[i*10], v.Operator(op).AttackRate; got != expect {
+			t.Errorf("VMEM operator block %d has attack rate %d, expected OP%d's %d", i, got, op, expect)
+		}
+	}
+}
+
+func TestParseSysex(t *testing.T) {
+	v := testVoice()
+
+	voices, err := Parse(VoiceSysex(v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(voices) != 1 || !reflect.DeepEqual(voices[0], v) {
+		t.Errorf("single voice dump came back as %+v", voices)
+	}
+
+	voices, err = Parse(BankSysex([]Voice{v}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(voices) != 32 {
+		t.Fatalf("bank dump has %d voices, expected 32", len(voices))
+	}
+	if !reflect.DeepEqual(voices[0], v) {
+		t.Errorf("bank voice 1 came back as %+v", voices[0])
+	}
+	if !bytes.Equal(voices[31].Packed(), InitVoice().Packed()) {
+		t.Errorf("empty bank slots should hold the init voice, got %+v", voices[31])
+	}
+
+	bad := VoiceSysex(v)
+	bad[len(bad)-2] ^= 0x01
+	if _, err := Parse(bad); err == nil {
+		t.Error("a bad checksum was accepted")
+	}
+}
@@ -0,0 +1,234 @@
+package generate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// Crossover makes a child out of two or more parents. Each operator comes whole
+// from one of them, preferably one where it plays the same part, carrier or
+// modulator, as in the child. The algorithm and feedback, the pitch EG and the
+// LFO each come from one parent as well.
+func Crossover(rng *rand.Rand, parents []parse.Voice) parse.Voice {
+	pick := func() parse.Voice {
+		return parents[rng.Intn(len(parents))]
+	}
+
+	child := pick()
+	child.Operators = make([]parse.Operator, 6)
+
+	structure := pick()
+	child.Algorithm, child.Feedback, child.OscKeySync = structure.Algorithm, structure.Feedback, structure.OscKeySync
+
+	pitch := pick()
+	child.PitchEGRate1, child.PitchEGRate2, child.PitchEGRate3, child.PitchEGRate4 = pitch.PitchEGRate1, pitch.PitchEGRate2, pitch.PitchEGRate3, pitch.PitchEGRate4
+	child.PitchEGLevel1, child.PitchEGLevel2, child.PitchEGLevel3, child.PitchEGLevel4 = pitch.PitchEGLevel1, pitch.PitchEGLevel2, pitch.PitchEGLevel3, pitch.PitchEGLevel4
+
+	lfo := pick()
+	child.LfoSpeed, child.LfoDelay, child.LfoPitchModDepth, child.LfoAMDepth = lfo.LfoSpeed, lfo.LfoDelay, lfo.LfoPitchModDepth, lfo.LfoAMDepth
+	child.LfoSync, child.LfoWave, child.LfoPitchModSensitivity = lfo.LfoSync, lfo.LfoWave, lfo.LfoPitchModSensitivity
+
+	topology := child.Topology()
+	for op := 1; op <= 6; op++ {
+		var same []parse.Voice
+		for _, parent := range parents {
+			if parent.Topology().IsCarrier(op) == topology.IsCarrier(op) {
+				same = append(same, parent)
+			}
+		}
+		if len(same) == 0 {
+			same = parents
+		}
+		child.Operators[6-op] = same[rng.Intn(len(same))].Operator(op)
+	}
+
+	return child
+}
+
+// Individual is one voice of a breeding session, the bank it is in and where it
+// came from.
+type Individual struct {
+	ID         string   `json:"id"`
+	Generation int      `json:"generation"` // 0 for the library voices it started from
+	Name       string   `json:"name"`
+	File       string   `json:"file"`
+	Parents    []string `json:"parents,omitempty"`
+	Starred    bool     `json:"starred,omitempty"`
+}
+
+// Session breeds generations of voices. Every generation is saved as a bank in the
+// session's folder, named after the session, and the lineage of every voice in a
+// JSON file beside them.
+type Session struct {
+	Name       string        `json:"session"`
+	Seed       int64         `json:"seed"`
+	Amount     float64       `json:"amount"`
+	Scope      string        `json:"scope"`
+	Generation int           `json:"generation"`
+	Lineage    []*Individual `json:"lineage"`
+
+	dir string
+}
+
+// NewSession starts a breeding session saving into dir, mutating the children by
+// amount (0 - 1) within scope.
+func NewSession(dir string, amount float64, scope string, seed int64) *Session {
+	return &Session{
+		Name:   time.Now().Format("BREED_20060102_150405"),
+		Seed:   seed,
+		Amount: amount,
+		Scope:  scope,
+		dir:    dir,
+	}
+}
+
+// LoadSession reads a session back from its lineage file, to carry on breeding.
+func LoadSession(fileName string) (*Session, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("reading %s: %s", fileName, err)
+	}
+	if err := CheckScope(s.Scope); err != nil {
+		return nil, fmt.Errorf("reading %s: %s", fileName, err)
+	}
+	s.dir = filepath.Dir(fileName)
+
+	return &s, nil
+}
+
+// Breed crosses the parents into a generation of count children, mutating each
+// one, and saves them as the session bank of the generation. The children are
+// named after their generation, like "G02-07".
+func (s *Session) Breed(parents []parse.Voice, count int) ([]parse.Voice, error) {
+	if len(parents) < 2 {
+		return nil, errors.New("breeding takes two or more parents")
+	}
+	if count < 1 || count > 32 {
+		return nil, fmt.Errorf("a generation is 1 - 32 voices, got %d", count)
+	}
+
+	ids := make([]string, len(parents))
+	for i, parent := range parents {
+		ids[i] = s.individual(parent).ID
+	}
+
+	generation := s.Generation + 1
+	file := s.Bank(generation)
+
+	// Each generation has its own seed, so a loaded session breeds as it would have
+	rng := rand.New(rand.NewSource(s.Seed + int64(generation)))
+
+	children := make([]parse.Voice, count)
+	for i := range children {
+		child := Mutate(rng, Crossover(rng, parents), s.Amount, s.Scope)
+		child.Name = fmt.Sprintf("G%02d-%02d", generation, i+1)
+		child.BankFileName = file
+		children[i] = child
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := parse.WriteBank(file, children); err != nil {
+		return nil, err
+	}
+
+	s.Generation = generation
+	for _, child := range children {
+		s.Lineage = append(s.Lineage, &Individual{ID: child.Name, Generation: generation, Name: child.Name, File: file, Parents: ids})
+	}
+
+	return children, s.Save()
+}
+
+// Bank is the file a generation of the session is saved in.
+func (s *Session) Bank(generation int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s_G%02d.syx", s.Name, generation))
+}
+
+// Find returns the individual a voice of the session is, nil for other voices. Names
+// read back from a bank are padded to ten characters, so spaces don't count.
+func (s *Session) Find(voice parse.Voice) *Individual {
+	name := strings.TrimSpace(voice.Name)
+	for _, individual := range s.Lineage {
+		if strings.TrimSpace(individual.Name) == name && individual.File == voice.BankFileName {
+			return individual
+		}
+	}
+	return nil
+}
+
+// ParentNames lists the names of the voices a voice of the session was bred from.
+func (s *Session) ParentNames(voice parse.Voice) []string {
+	individual := s.Find(voice)
+	if individual == nil {
+		return nil
+	}
+
+	var names []string
+	for _, id := range individual.Parents {
+		for _, parent := range s.Lineage {
+			if parent.ID == id {
+				names = append(names, parent.Name)
+			}
+		}
+	}
+	return names
+}
+
+// Star marks a voice of the session as a favorite in the lineage.
+func (s *Session) Star(voice parse.Voice, starred bool) error {
+	if individual := s.Find(voice); individual != nil {
+		individual.Starred = starred
+		return s.Save()
+	}
+	return nil
+}
+
+// Save writes the lineage file.
+func (s *Session) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.LineageFile(), append(data, '\n'), 0644)
+}
+
+// LineageFile is where Save writes the session.
+func (s *Session) LineageFile() string {
+	return filepath.Join(s.dir, s.Name+".json")
+}
+
+// individual finds a parent in the lineage, adding library voices as generation 0.
+func (s *Session) individual(voice parse.Voice) *Individual {
+	if individual := s.Find(voice); individual != nil {
+		return individual
+	}
+
+	count := 0
+	for _, individual := range s.Lineage {
+		if individual.Generation == 0 {
+			count++
+		}
+	}
+
+	individual := &Individual{ID: fmt.Sprintf("G00-%02d", count+1), Name: voice.Name, File: voice.BankFileName}
+	s.Lineage = append(s.Lineage, individual)
+	return individual
+}
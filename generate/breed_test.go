@@ -0,0 +1,177 @@
+package generate
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// parentsOf are library voices on different algorithms, so operators play
+// different parts in different parents.
+func parentsOf(t *testing.T) []parse.Voice {
+	t.Helper()
+
+	parents := libraryVoices(t)[:3]
+	for i, algorithm := range []byte{0, 4, 31} {
+		parents[i].Algorithm = algorithm
+	}
+	return parents
+}
+
+func TestCrossover(t *testing.T) {
+	parents := parentsOf(t)
+	rng := rand.New(rand.NewSource(3))
+
+	for try := 0; try < 200; try++ {
+		child := Crossover(rng, parents)
+		topology := child.Topology()
+
+		from := func(same func(p parse.Voice) bool) bool {
+			for _, p := range parents {
+				if same(p) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if !from(func(p parse.Voice) bool {
+			return p.Algorithm == child.Algorithm && p.Feedback == child.Feedback && p.OscKeySync == child.OscKeySync
+		}) {
+			t.Errorf("the algorithm, feedback and key sync of the child don't come from one parent")
+		}
+		if !from(func(p parse.Voice) bool {
+			return p.PitchEGRate1 == child.PitchEGRate1 && p.PitchEGRate4 == child.PitchEGRate4 && p.PitchEGLevel1 == child.PitchEGLevel1 && p.PitchEGLevel4 == child.PitchEGLevel4
+		}) {
+			t.Errorf("the pitch EG of the child doesn't come from one parent")
+		}
+		if !from(func(p parse.Voice) bool {
+			return p.LfoSpeed == child.LfoSpeed && p.LfoWave == child.LfoWave && p.LfoPitchModSensitivity == child.LfoPitchModSensitivity && p.LfoSync == child.LfoSync
+		}) {
+			t.Errorf("the LFO of the child doesn't come from one parent")
+		}
+		if !from(func(p parse.Voice) bool { return p.Name == child.Name }) {
+			t.Errorf("the child is named [%s], not after a parent", child.Name)
+		}
+
+		for op := 1; op <= 6; op++ {
+			// Taken whole from a parent where it plays the same part, if there is one
+			role := from(func(p parse.Voice) bool { return p.Topology().IsCarrier(op) == topology.IsCarrier(op) })
+			if !from(func(p parse.Voice) bool {
+				return p.Operator(op) == child.Operator(op) && (!role || p.Topology().IsCarrier(op) == topology.IsCarrier(op))
+			}) {
+				t.Errorf("OP%d of the child doesn't come from a parent where it plays the same part", op)
+			}
+		}
+	}
+
+	a := Crossover(rand.New(rand.NewSource(9)), parents)
+	b := Crossover(rand.New(rand.NewSource(9)), parents)
+	if !bytes.Equal(a.Unpacked(), b.Unpacked()) {
+		t.Error("the same seed gave different children")
+	}
+}
+
+func TestSession(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "breeding")
+	parents := parentsOf(t)
+
+	s := NewSession(dir, 0.2, ScopeAll, 42)
+	first, err := s.Breed(parents, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 32 || first[0].Name != "G01-01" || first[31].Name != "G01-32" {
+		t.Fatalf("the first generation is %d voices from [%s]", len(first), first[0].Name)
+	}
+	checkRanges(t, "first generation", first...)
+
+	if _, err := os.Stat(s.Bank(1)); err != nil {
+		t.Errorf("the first generation wasn't saved: %s", err)
+	}
+	if filepath.Dir(s.Bank(1)) != dir || filepath.Dir(s.LineageFile()) != dir {
+		t.Errorf("the session saves outside its folder, to %s and %s", s.Bank(1), s.LineageFile())
+	}
+
+	second, err := s.Breed(first[:2], 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Star(second[1], true); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadSession(s.LineageFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, s) {
+		t.Errorf("loaded %+v, saved %+v", loaded, s)
+	}
+	if got := loaded.ParentNames(second[0]); !reflect.DeepEqual(got, []string{"G01-01", "G01-02"}) {
+		t.Errorf("loaded parents of G02-01 are %v", got)
+	}
+	if got := loaded.ParentNames(first[0]); len(got) != 3 {
+		t.Errorf("loaded parents of G01-01 are %v, want the three library voices", got)
+	}
+	if individual := loaded.Find(second[1]); individual == nil || !individual.Starred {
+		t.Errorf("the star on G02-02 was lost: %+v", individual)
+	}
+
+	// The saved banks read back as the generations
+	for generation, voices := range map[int][]parse.Voice{1: first, 2: second} {
+		bank, _, err := parse.Open(loaded.Bank(generation), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, voice := range voices {
+			if !bytes.Equal(bank.Voices[i].Unpacked(), voice.Unpacked()) {
+				t.Errorf("generation %d voice %d changed on disk", generation, i+1)
+			}
+			if loaded.Find(bank.Voices[i]) == nil {
+				t.Errorf("generation %d voice %d read back isn't in the lineage", generation, i+1)
+			}
+		}
+	}
+
+	// Carrying on after loading breeds the same as carrying on without
+	third, err := s.Breed(second, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := loaded.Breed(second, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range third {
+		if !bytes.Equal(third[i].Unpacked(), again[i].Unpacked()) {
+			t.Errorf("voice %d of the third generation differs after loading", i+1)
+		}
+	}
+}
+
+func TestBreedErrors(t *testing.T) {
+	s := NewSession(t.TempDir(), 0.2, ScopeAll, 1)
+	parents := parentsOf(t)
+
+	if _, err := s.Breed(parents[:1], 32); err == nil {
+		t.Error("breeding one parent gave no error")
+	}
+	for _, count := range []int{0, 33} {
+		if _, err := s.Breed(parents, count); err == nil {
+			t.Errorf("a generation of %d gave no error", count)
+		}
+	}
+	if s.Generation != 0 || len(s.Lineage) != 0 {
+		t.Errorf("failed breeding left generation %d and %d individuals", s.Generation, len(s.Lineage))
+	}
+
+	if _, err := LoadSession(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("loading a missing session gave no error")
+	}
+}
@@ -0,0 +1,147 @@
+// Package generate makes new voices out of existing ones.
+package generate
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// Morph returns the voice at t between a (0) and b (1). Rates, levels, depths and
+// the like are interpolated, frequencies in pitch. The switches, algorithm, curves,
+// oscillator mode, LFO wave and syncs, can't be in between so they flip halfway, as
+// does the name.
+func Morph(a parse.Voice, b parse.Voice, t float64) parse.Voice {
+	t = math.Max(0, math.Min(1, t))
+
+	voice := parse.Voice{
+		Operators: make([]parse.Operator, len(a.Operators)),
+
+		PitchEGRate1:  mix(a.PitchEGRate1, b.PitchEGRate1, t),
+		PitchEGRate2:  mix(a.PitchEGRate2, b.PitchEGRate2, t),
+		PitchEGRate3:  mix(a.PitchEGRate3, b.PitchEGRate3, t),
+		PitchEGRate4:  mix(a.PitchEGRate4, b.PitchEGRate4, t),
+		PitchEGLevel1: mix(a.PitchEGLevel1, b.PitchEGLevel1, t),
+		PitchEGLevel2: mix(a.PitchEGLevel2, b.PitchEGLevel2, t),
+		PitchEGLevel3: mix(a.PitchEGLevel3, b.PitchEGLevel3, t),
+		PitchEGLevel4: mix(a.PitchEGLevel4, b.PitchEGLevel4, t),
+
+		Algorithm:  flip(a.Algorithm, b.Algorithm, t),
+		Feedback:   mix(a.Feedback, b.Feedback, t),
+		OscKeySync: flip(a.OscKeySync, b.OscKeySync, t),
+
+		LfoSpeed:               mix(a.LfoSpeed, b.LfoSpeed, t),
+		LfoDelay:               mix(a.LfoDelay, b.LfoDelay, t),
+		LfoPitchModDepth:       mix(a.LfoPitchModDepth, b.LfoPitchModDepth, t),
+		LfoAMDepth:             mix(a.LfoAMDepth, b.LfoAMDepth, t),
+		LfoSync:                flip(a.LfoSync, b.LfoSync, t),
+		LfoWave:                flip(a.LfoWave, b.LfoWave, t),
+		LfoPitchModSensitivity: mix(a.LfoPitchModSensitivity, b.LfoPitchModSensitivity, t),
+
+		Transpose: mix(a.Transpose, b.Transpose, t),
+		Name:      a.Name,
+	}
+	if t >= 0.5 {
+		voice.Name = b.Name
+	}
+
+	for i := range voice.Operators {
+		if i < len(b.Operators) {
+			voice.Operators[i] = morphOperator(a.Operators[i], b.Operators[i], t)
+		}
+	}
+
+	return voice
+}
+
+// Steps returns count voices going from a to b in even steps, a and b included.
+// The ones in between are named by how far along they are.
+func Steps(a parse.Voice, b parse.Voice, count int) []parse.Voice {
+	if count < 2 {
+		return []parse.Voice{a, b}
+	}
+
+	voices := make([]parse.Voice, count)
+	for i := range voices {
+		t := float64(i) / float64(count-1)
+		voices[i] = Morph(a, b, t)
+		if i > 0 && i < count-1 {
+			voices[i].Name = fmt.Sprintf("MORPH %03d", int(math.Round(t*100)))
+		}
+	}
+	voices[0], voices[count-1] = a, b
+
+	return voices
+}
+
+func morphOperator(a parse.Operator, b parse.Operator, t float64) parse.Operator {
+	o := parse.Operator{
+		EGRate1:  mix(a.EGRate1, b.EGRate1, t),
+		EGRate2:  mix(a.EGRate2, b.EGRate2, t),
+		EGRate3:  mix(a.EGRate3, b.EGRate3, t),
+		EGRate4:  mix(a.EGRate4, b.EGRate4, t),
+		EGLevel1: mix(a.EGLevel1, b.EGLevel1, t),
+		EGLevel2: mix(a.EGLevel2, b.EGLevel2, t),
+		EGLevel3: mix(a.EGLevel3, b.EGLevel3, t),
+		EGLevel4: mix(a.EGLevel4, b.EGLevel4, t),
+
+		LevelScalingBreakPoint: mix(a.LevelScalingBreakPoint, b.LevelScalingBreakPoint, t),
+		ScaleLeftDepth:         mix(a.ScaleLeftDepth, b.ScaleLeftDepth, t),
+		ScaleRightDepth:        mix(a.ScaleRightDepth, b.ScaleRightDepth, t),
+		ScaleLeftCurve:         flip(a.ScaleLeftCurve, b.ScaleLeftCurve, t),
+		ScaleRightCurve:        flip(a.ScaleRightCurve, b.ScaleRightCurve, t),
+		RateScale:              mix(a.RateScale, b.RateScale, t),
+		Detune:                 mix(a.Detune, b.Detune, t),
+
+		AmplitudeModulationSensitivity: mix(a.AmplitudeModulationSensitivity, b.AmplitudeModulationSensitivity, t),
+		KeyVelocitySensitivity:         mix(a.KeyVelocitySensitivity, b.KeyVelocitySensitivity, t),
+		OutputLevel:                    mix(a.OutputLevel, b.OutputLevel, t),
+
+		OscillatorMode: flip(a.OscillatorMode, b.OscillatorMode, t),
+	}
+
+	switch {
+	case t == 0 || t == 1:
+		// A ratio can be set more than one way, keep the ends as they were
+		o.FrequencyCoarse, o.FrequencyFine = flip(a.FrequencyCoarse, b.FrequencyCoarse, t), flip(a.FrequencyFine, b.FrequencyFine, t)
+	case a.OscillatorMode != b.OscillatorMode:
+		// No pitch in between a ratio and a fixed frequency, the frequency goes with the mode
+		o.FrequencyCoarse, o.FrequencyFine = flip(a.FrequencyCoarse, b.FrequencyCoarse, t), flip(a.FrequencyFine, b.FrequencyFine, t)
+	case o.OscillatorMode == 1:
+		// Fixed frequencies are 10 to the power of coarse (0 - 3) plus fine / 100
+		from := float64(a.FrequencyCoarse&3) + float64(a.FrequencyFine)/100
+		to := float64(b.FrequencyCoarse&3) + float64(b.FrequencyFine)/100
+		exponent := from + (to-from)*t
+		coarse := math.Min(3, math.Floor(exponent))
+		o.FrequencyCoarse = byte(coarse)
+		o.FrequencyFine = byte(math.Min(99, math.Round((exponent-coarse)*100)))
+	default:
+		from, to := math.Log2(a.Ratio()), math.Log2(b.Ratio())
+		o.FrequencyCoarse, o.FrequencyFine = coarseFine(math.Exp2(from + (to-from)*t))
+	}
+
+	return o
+}
+
+// coarseFine finds the coarse and fine frequency settings closest to a ratio.
+func coarseFine(ratio float64) (byte, byte) {
+	if ratio < 1 {
+		return 0, byte(math.Max(0, math.Min(99, math.Round((ratio/0.5-1)*100))))
+	}
+	coarse := math.Min(31, math.Floor(ratio))
+	return byte(coarse), byte(math.Min(99, math.Round((ratio/coarse-1)*100)))
+}
+
+// mix interpolates between two parameter values.
+func mix(a byte, b byte, t float64) byte {
+	return byte(math.Round(float64(a) + (float64(b)-float64(a))*t))
+}
+
+// flip picks a before halfway and b after.
+func flip(a byte, b byte, t float64) byte {
+	if t < 0.5 {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,96 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// libraryVoices are the voices of a bank from the library.
+func libraryVoices(t *testing.T) []parse.Voice {
+	t.Helper()
+
+	bank, _, err := parse.Open("../sysex/DX7_AllTheWeb/Godric/piano10.syx", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bank.Voices
+}
+
+// checkRanges fails the test if any parameter of the voices is outside what the
+// synth takes, by the same checks an import makes.
+func checkRanges(t *testing.T, what string, voices ...parse.Voice) {
+	t.Helper()
+
+	data, err := parse.ExportJSON(voices)
+	if err != nil {
+		t.Fatalf("%s: %s", what, err)
+	}
+	if _, err := parse.Import(data); err != nil {
+		t.Errorf("%s: %s", what, err)
+	}
+}
+
+func TestMorphEnds(t *testing.T) {
+	voices := libraryVoices(t)
+
+	for i := 0; i+1 < len(voices); i++ {
+		a, b := voices[i], voices[i+1]
+
+		if got := Morph(a, b, 0); !bytes.Equal(got.Unpacked(), a.Unpacked()) {
+			t.Errorf("Morph(%s, %s, 0) is not %s", a.Name, b.Name, a.Name)
+		}
+		if got := Morph(a, b, 1); !bytes.Equal(got.Unpacked(), b.Unpacked()) {
+			t.Errorf("Morph(%s, %s, 1) is not %s", a.Name, b.Name, b.Name)
+		}
+	}
+}
+
+func TestMorphInBetween(t *testing.T) {
+	ratio := parse.InitVoice()
+	ratio.Operators[5].FrequencyCoarse, ratio.Operators[5].FrequencyFine = 0, 99
+	ratio.Operators[4].FrequencyCoarse, ratio.Operators[4].FrequencyFine = 31, 99
+
+	fixed := parse.InitVoice()
+	for i := range fixed.Operators {
+		fixed.Operators[i].OscillatorMode = 1
+	}
+	fixed.Operators[5].FrequencyCoarse, fixed.Operators[5].FrequencyFine = 3, 99
+	fixed.Operators[4].FrequencyCoarse, fixed.Operators[4].FrequencyFine = 0, 0
+	fixed.Operators[3].FrequencyCoarse, fixed.Operators[3].FrequencyFine = 31, 50 // only the low two bits count
+
+	low := fixed
+	low.Operators = append([]parse.Operator{}, fixed.Operators...)
+	low.Operators[5].FrequencyCoarse, low.Operators[5].FrequencyFine = 0, 0
+	low.Operators[4].FrequencyCoarse, low.Operators[4].FrequencyFine = 3, 99
+
+	pairs := [][2]parse.Voice{{ratio, fixed}, {fixed, low}, {ratio, parse.InitVoice()}}
+	library := libraryVoices(t)
+	pairs = append(pairs, [2]parse.Voice{library[0], library[len(library)-1]}, [2]parse.Voice{library[3], fixed})
+
+	for _, pair := range pairs {
+		a, b := pair[0], pair[1]
+		for step := 0; step <= 20; step++ {
+			at := float64(step) / 20
+			voice := Morph(a, b, at)
+			checkRanges(t, fmt.Sprintf("%s to %s at %.2f", a.Name, b.Name, at), voice)
+
+			for op := 1; op <= 6; op++ {
+				o, from, to := voice.Operator(op), a.Operator(op), b.Operator(op)
+				if o.OscillatorMode != 1 || from.OscillatorMode != 1 || to.OscillatorMode != 1 {
+					continue
+				}
+				// Fixed frequencies move in pitch from one end to the other
+				lo, hi := from.FixedFrequency(), to.FixedFrequency()
+				if lo > hi {
+					lo, hi = hi, lo
+				}
+				if hz := o.FixedFrequency(); hz < lo*0.999 || hz > hi*1.001 {
+					t.Errorf("OP%d at %.2f is %.1f Hz, outside %.1f - %.1f Hz", op, at, hz, lo, hi)
+				}
+			}
+		}
+	}
+}
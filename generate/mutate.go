@@ -0,0 +1,156 @@
+package generate
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// Mutation scopes, what Mutate is allowed to touch.
+const (
+	ScopeAll        = "all"
+	ScopeEG         = "eg"
+	ScopeRatios     = "ratios"
+	ScopeModulators = "modulators"
+	ScopeLFO        = "lfo"
+)
+
+// Scopes lists the mutation scopes.
+var Scopes = []string{ScopeAll, ScopeEG, ScopeRatios, ScopeModulators, ScopeLFO}
+
+// CheckScope tells if scope is one of Scopes.
+func CheckScope(scope string) error {
+	for _, s := range Scopes {
+		if s == scope {
+			return nil
+		}
+	}
+	return fmt.Errorf("scope must be one of %s, got [%s]", strings.Join(Scopes, ", "), scope)
+}
+
+// Mutate returns a variation of voice. Amount, 0 - 1, is both how likely each
+// parameter in scope is to change and how far it moves. The algorithm stays, ratios
+// stay whole or near whole, and carriers stay audible.
+func Mutate(rng *rand.Rand, voice parse.Voice, amount float64, scope string) parse.Voice {
+	m := mutator{rng: rng, amount: math.Max(0, math.Min(1, amount))}
+
+	// A small amount over a small scope can miss every parameter, try again then
+	for try := 0; try < 10; try++ {
+		if v := m.mutate(voice, scope); len(parse.Diff(voice, v)) > 0 {
+			return v
+		}
+	}
+	return voice
+}
+
+func (m mutator) mutate(voice parse.Voice, scope string) parse.Voice {
+	rng := m.rng
+	v := voice
+	v.Operators = make([]parse.Operator, len(voice.Operators))
+	copy(v.Operators, voice.Operators)
+
+	topology := v.Topology()
+
+	all := scope == ScopeAll
+	if all || scope == ScopeLFO {
+		m.nudge(&v.LfoSpeed, 99)
+		m.nudge(&v.LfoDelay, 99)
+		m.nudge(&v.LfoPitchModDepth, 99)
+		m.nudge(&v.LfoAMDepth, 99)
+		m.nudge(&v.LfoPitchModSensitivity, 7)
+		if m.chance() {
+			v.LfoWave = byte(rng.Intn(6))
+		}
+	}
+	if all {
+		m.nudge(&v.Feedback, 7)
+	}
+
+	for op := 1; op <= 6 && len(v.Operators) == 6; op++ {
+		o := &v.Operators[6-op]
+		carrier := topology.IsCarrier(op)
+
+		if all || scope == ScopeEG || (scope == ScopeModulators && !carrier) {
+			for _, p := range []*byte{&o.EGRate1, &o.EGRate2, &o.EGRate3, &o.EGRate4, &o.EGLevel1, &o.EGLevel2, &o.EGLevel3} {
+				m.nudge(p, 99)
+			}
+		}
+
+		if (all || scope == ScopeRatios || (scope == ScopeModulators && !carrier)) && o.OscillatorMode == 0 {
+			if m.chance() {
+				coarse := int(o.FrequencyCoarse) + []int{-2, -1, 1, 2}[rng.Intn(4)]
+				o.FrequencyCoarse = byte(math.Max(0, math.Min(31, float64(coarse))))
+				o.FrequencyFine = 0
+			}
+			if m.chance() && m.chance() {
+				// An occasional near whole ratio, for a little beating or a bell
+				o.FrequencyFine = byte(rng.Intn(4))
+			}
+			m.nudge(&o.Detune, 14)
+		}
+
+		if all || (scope == ScopeModulators && !carrier) {
+			m.nudge(&o.KeyVelocitySensitivity, 7)
+			m.nudge(&o.RateScale, 7)
+			m.nudge(&o.ScaleLeftDepth, 99)
+			m.nudge(&o.ScaleRightDepth, 99)
+
+			level := o.OutputLevel
+			m.nudge(&o.OutputLevel, 99)
+			if carrier && o.OutputLevel < level && o.OutputLevel < 80 {
+				o.OutputLevel = level
+			}
+		}
+	}
+
+	return v
+}
+
+// Variations makes count mutations of voice from a seed. They keep the start of
+// the voice's name with a number after it, like "E.PIANO 07".
+func Variations(voice parse.Voice, count int, amount float64, scope string, seed int64) []parse.Voice {
+	rng := rand.New(rand.NewSource(seed))
+
+	voices := make([]parse.Voice, count)
+	for i := range voices {
+		voices[i] = Mutate(rng, voice, amount, scope)
+		voices[i].Name = fmt.Sprintf("%-7.7s %02d", strings.TrimSpace(voice.Name), i+1)
+	}
+
+	return voices
+}
+
+// mutator nudges parameters by an amount.
+type mutator struct {
+	rng    *rand.Rand
+	amount float64
+}
+
+// chance is true as often as the amount.
+func (m mutator) chance() bool {
+	return m.rng.Float64() < m.amount
+}
+
+// nudge moves a parameter some of the way across its range, by chance.
+func (m mutator) nudge(p *byte, limit int) {
+	if !m.chance() {
+		return
+	}
+
+	step := int(math.Round(m.rng.NormFloat64() * m.amount * float64(limit) / 4))
+	if step == 0 {
+		step = 1 - 2*m.rng.Intn(2)
+	}
+
+	value := int(*p) + step
+	if value < 0 {
+		value = 0
+	}
+	if value > limit {
+		value = limit
+	}
+	*p = byte(value)
+}
@@ -0,0 +1,139 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// scopeFields are the voice and operator parameters each scope may change, the
+// operator ones for any operator.
+var scopeFields = map[string][]string{
+	ScopeLFO:    {"LfoSpeed", "LfoDelay", "LfoPitchModDepth", "LfoAMDepth", "LfoPitchModSensitivity", "LfoWave"},
+	ScopeEG:     {"EGRate1", "EGRate2", "EGRate3", "EGRate4", "EGLevel1", "EGLevel2", "EGLevel3"},
+	ScopeRatios: {"FrequencyCoarse", "FrequencyFine", "Detune"},
+	ScopeModulators: {"EGRate1", "EGRate2", "EGRate3", "EGRate4", "EGLevel1", "EGLevel2", "EGLevel3",
+		"FrequencyCoarse", "FrequencyFine", "Detune",
+		"KeyVelocitySensitivity", "RateScale", "ScaleLeftDepth", "ScaleRightDepth", "OutputLevel"},
+}
+
+func init() {
+	all := []string{"Feedback"}
+	for _, scope := range []string{ScopeLFO, ScopeModulators} {
+		all = append(all, scopeFields[scope]...)
+	}
+	scopeFields[ScopeAll] = all
+}
+
+// allowed tells if a scope may change a field parse.Diff reports, like "OP3 Detune".
+func allowed(voice parse.Voice, scope string, field string) bool {
+	op := 0
+	if strings.HasPrefix(field, "OP") {
+		fmt.Sscanf(field, "OP%d %s", &op, &field)
+	}
+
+	for _, name := range scopeFields[scope] {
+		if name != field {
+			continue
+		}
+		if op > 0 && (strings.HasPrefix(field, "Frequency") || field == "Detune") && voice.Operator(op).OscillatorMode != 0 {
+			// Fixed frequencies are left alone
+			return false
+		}
+		if op > 0 && scope == ScopeModulators && voice.Topology().IsCarrier(op) {
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+func TestMutateScopes(t *testing.T) {
+	voices := libraryVoices(t)
+	fixed := parse.InitVoice()
+	fixed.Operators[2].OscillatorMode = 1
+	voices = append(voices, fixed)
+
+	for _, scope := range Scopes {
+		var all []parse.Voice
+		for _, amount := range []float64{0.05, 0.3, 1} {
+			rng := rand.New(rand.NewSource(7))
+			for _, voice := range voices {
+				for try := 0; try < 2; try++ {
+					mutated := Mutate(rng, voice, amount, scope)
+					what := fmt.Sprintf("%s %.0f%% of [%s]", scope, amount*100, voice.Name)
+
+					// A small amount over a small scope can miss everything
+					diffs := parse.Diff(voice, mutated)
+					if len(diffs) == 0 && amount == 1 {
+						t.Errorf("%s changed nothing", what)
+					}
+					for _, d := range diffs {
+						if !allowed(voice, scope, d.Field) {
+							t.Errorf("%s changed %s from %s to %s", what, d.Field, d.A, d.B)
+						}
+					}
+
+					// Carriers stay audible
+					for op := 1; op <= 6; op++ {
+						before, after := voice.Operator(op).OutputLevel, mutated.Operator(op).OutputLevel
+						if voice.Topology().IsCarrier(op) && after < before && after < 80 {
+							t.Errorf("%s turned carrier OP%d down from %d to %d", what, op, before, after)
+						}
+					}
+
+					all = append(all, mutated)
+				}
+			}
+		}
+		checkRanges(t, scope, all...)
+	}
+}
+
+func TestMutateLeavesVoiceAlone(t *testing.T) {
+	voice := parse.InitVoice()
+	before := voice.Unpacked()
+
+	Mutate(rand.New(rand.NewSource(1)), voice, 1, ScopeAll)
+	if !bytes.Equal(voice.Unpacked(), before) {
+		t.Error("Mutate changed the voice it was given")
+	}
+}
+
+func TestVariations(t *testing.T) {
+	voice := libraryVoices(t)[0]
+
+	a := Variations(voice, 32, 0.2, ScopeAll, 99)
+	b := Variations(voice, 32, 0.2, ScopeAll, 99)
+	if len(a) != 32 {
+		t.Fatalf("got %d variations, want 32", len(a))
+	}
+
+	prefix := fmt.Sprintf("%-7.7s", strings.TrimSpace(voice.Name))
+	for i := range a {
+		if !bytes.Equal(a[i].Unpacked(), b[i].Unpacked()) {
+			t.Errorf("variation %d differs between two runs with the same seed", i+1)
+		}
+		if want := fmt.Sprintf("%s %02d", prefix, i+1); a[i].Name != want {
+			t.Errorf("variation %d is named [%s], want [%s]", i+1, a[i].Name, want)
+		}
+	}
+	checkRanges(t, "variations", a...)
+}
+
+func TestCheckScope(t *testing.T) {
+	for _, scope := range Scopes {
+		if err := CheckScope(scope); err != nil {
+			t.Errorf("CheckScope(%q): %s", scope, err)
+		}
+	}
+	for _, scope := range []string{"", "ALL", "everything"} {
+		if err := CheckScope(scope); err == nil {
+			t.Errorf("CheckScope(%q) gave no error", scope)
+		}
+	}
+}
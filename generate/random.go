@@ -0,0 +1,208 @@
+package generate
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// span is an inclusive range of parameter values to pick from.
+type span [2]int
+
+// frequency is a coarse and fine frequency setting.
+type frequency [2]byte
+
+// envelope holds the ranges of the four EG rates and levels.
+type envelope struct {
+	rates  [4]span
+	levels [4]span
+}
+
+// family describes what a kind of sound tends to look like, random voices are
+// picked from inside these ranges instead of across the whole parameter space.
+type family struct {
+	algorithms      []int // 1 - 32
+	carrier         envelope
+	modulator       envelope
+	carrierRatios   []frequency
+	modulatorRatios []frequency
+	modulatorLevel  span
+	feedback        span
+	velocity        span
+	detune          span
+	vibrato         bool
+}
+
+// Families are the kinds of voices Random knows how to make.
+var Families = []string{"bass", "bell", "keys", "lead", "pad"}
+
+var families = map[string]family{
+	"bass": {
+		algorithms:      []int{1, 2, 3, 5, 7, 16, 17, 18},
+		carrier:         envelope{rates: [4]span{{95, 99}, {40, 70}, {20, 50}, {60, 80}}, levels: [4]span{{99, 99}, {80, 95}, {60, 85}, {0, 0}}},
+		modulator:       envelope{rates: [4]span{{90, 99}, {45, 75}, {25, 50}, {60, 80}}, levels: [4]span{{99, 99}, {70, 90}, {40, 70}, {0, 0}}},
+		carrierRatios:   []frequency{{1, 0}, {1, 0}, {0, 0}},
+		modulatorRatios: []frequency{{1, 0}, {1, 0}, {2, 0}, {0, 0}, {3, 0}},
+		modulatorLevel:  span{65, 85},
+		feedback:        span{3, 7},
+		velocity:        span{2, 5},
+		detune:          span{5, 9},
+	},
+	"bell": {
+		algorithms:      []int{5, 6, 11, 22, 25, 29},
+		carrier:         envelope{rates: [4]span{{95, 99}, {25, 45}, {15, 35}, {25, 45}}, levels: [4]span{{99, 99}, {70, 85}, {0, 0}, {0, 0}}},
+		modulator:       envelope{rates: [4]span{{95, 99}, {30, 50}, {20, 40}, {30, 50}}, levels: [4]span{{99, 99}, {60, 85}, {0, 20}, {0, 0}}},
+		carrierRatios:   []frequency{{1, 0}, {1, 0}, {2, 0}},
+		modulatorRatios: []frequency{{3, 17}, {1, 41}, {2, 38}, {4, 0}, {5, 4}, {7, 0}},
+		modulatorLevel:  span{55, 85},
+		feedback:        span{0, 3},
+		velocity:        span{1, 4},
+		detune:          span{4, 10},
+	},
+	"keys": {
+		algorithms:      []int{1, 2, 5, 6, 8, 10},
+		carrier:         envelope{rates: [4]span{{90, 99}, {50, 75}, {20, 40}, {50, 70}}, levels: [4]span{{99, 99}, {80, 95}, {0, 50}, {0, 0}}},
+		modulator:       envelope{rates: [4]span{{90, 99}, {55, 80}, {25, 45}, {50, 70}}, levels: [4]span{{99, 99}, {70, 90}, {0, 40}, {0, 0}}},
+		carrierRatios:   []frequency{{1, 0}},
+		modulatorRatios: []frequency{{1, 0}, {1, 0}, {2, 0}, {3, 0}, {14, 0}},
+		modulatorLevel:  span{50, 80},
+		feedback:        span{0, 5},
+		velocity:        span{3, 6},
+		detune:          span{5, 9},
+	},
+	"lead": {
+		algorithms:      []int{1, 2, 3, 4, 16, 17, 18},
+		carrier:         envelope{rates: [4]span{{80, 99}, {50, 80}, {30, 60}, {55, 75}}, levels: [4]span{{99, 99}, {90, 99}, {85, 95}, {0, 0}}},
+		modulator:       envelope{rates: [4]span{{75, 99}, {50, 80}, {30, 60}, {55, 75}}, levels: [4]span{{99, 99}, {85, 99}, {75, 95}, {0, 0}}},
+		carrierRatios:   []frequency{{1, 0}, {1, 0}, {2, 0}},
+		modulatorRatios: []frequency{{1, 0}, {2, 0}, {3, 0}, {1, 1}},
+		modulatorLevel:  span{60, 85},
+		feedback:        span{4, 7},
+		velocity:        span{0, 3},
+		detune:          span{5, 9},
+		vibrato:         true,
+	},
+	"pad": {
+		algorithms:      []int{5, 6, 15, 19, 22, 25, 29, 31},
+		carrier:         envelope{rates: [4]span{{35, 60}, {30, 50}, {20, 40}, {30, 50}}, levels: [4]span{{90, 99}, {85, 99}, {80, 95}, {0, 0}}},
+		modulator:       envelope{rates: [4]span{{30, 60}, {25, 50}, {20, 40}, {30, 50}}, levels: [4]span{{80, 99}, {75, 95}, {70, 90}, {0, 0}}},
+		carrierRatios:   []frequency{{1, 0}, {1, 0}, {2, 0}},
+		modulatorRatios: []frequency{{1, 0}, {2, 0}, {3, 0}, {1, 1}},
+		modulatorLevel:  span{45, 75},
+		feedback:        span{0, 4},
+		velocity:        span{0, 3},
+		detune:          span{3, 11},
+		vibrato:         true,
+	},
+}
+
+// RandomOptions narrow down the voices Random makes.
+type RandomOptions struct {
+	Family    string // one of Families, empty for any
+	Algorithm int    // 1 - 32, 0 for one that suits the family
+}
+
+// Check tells what is wrong with the options, if anything.
+func (o RandomOptions) Check() error {
+	if _, ok := families[o.Family]; o.Family != "" && !ok {
+		return fmt.Errorf("family must be one of %s, got [%s]", strings.Join(Families, ", "), o.Family)
+	}
+	if o.Algorithm < 0 || o.Algorithm > 32 {
+		return fmt.Errorf("algorithm must be 1 - 32, got %d", o.Algorithm)
+	}
+	return nil
+}
+
+// Random makes a playable voice: carriers at audible levels, integer or near integer
+// ratios and envelopes shaped like the family's. The voice is named after its family.
+func Random(rng *rand.Rand, options RandomOptions) parse.Voice {
+	name := options.Family
+	if name == "" {
+		name = Families[rng.Intn(len(Families))]
+	}
+	f := families[name]
+
+	algorithm := options.Algorithm
+	if algorithm == 0 {
+		algorithm = f.algorithms[rng.Intn(len(f.algorithms))]
+	}
+	topology := parse.Algorithms[algorithm-1]
+
+	voice := parse.InitVoice()
+	voice.Name = strings.ToUpper(name)
+	voice.Algorithm = byte(algorithm - 1)
+	voice.Feedback = pick(rng, f.feedback)
+	voice.OscKeySync = 1
+
+	voice.LfoWave = 4 // sine
+	voice.LfoSync = 0
+	if f.vibrato {
+		voice.LfoSpeed = pick(rng, span{25, 40})
+		voice.LfoDelay = pick(rng, span{20, 60})
+		voice.LfoPitchModDepth = pick(rng, span{2, 8})
+		voice.LfoPitchModSensitivity = pick(rng, span{2, 4})
+	}
+
+	// Several carriers add up, so leave them a little headroom
+	headroom := 2 * (len(topology.Carriers) - 1)
+
+	for op := 1; op <= 6; op++ {
+		o := &voice.Operators[6-op]
+
+		eg, ratios := f.modulator, f.modulatorRatios
+		if topology.IsCarrier(op) {
+			eg, ratios = f.carrier, f.carrierRatios
+		}
+
+		o.EGRate1, o.EGRate2, o.EGRate3, o.EGRate4 = pick(rng, eg.rates[0]), pick(rng, eg.rates[1]), pick(rng, eg.rates[2]), pick(rng, eg.rates[3])
+		o.EGLevel1, o.EGLevel2, o.EGLevel3, o.EGLevel4 = pick(rng, eg.levels[0]), pick(rng, eg.levels[1]), pick(rng, eg.levels[2]), pick(rng, eg.levels[3])
+
+		r := ratios[rng.Intn(len(ratios))]
+		o.OscillatorMode = 0
+		o.FrequencyCoarse, o.FrequencyFine = r[0], r[1]
+		o.Detune = pick(rng, f.detune)
+		o.KeyVelocitySensitivity = pick(rng, f.velocity)
+		o.LevelScalingBreakPoint = pick(rng, span{27, 51})
+
+		if topology.IsCarrier(op) {
+			o.OutputLevel = pick(rng, span{92 - headroom, 99 - headroom})
+			o.RateScale = pick(rng, span{0, 3})
+		} else {
+			// Modulators get darker up the keyboard, like most factory voices
+			o.OutputLevel = pick(rng, f.modulatorLevel)
+			o.RateScale = pick(rng, span{1, 4})
+			o.ScaleRightDepth = pick(rng, span{0, 30})
+			o.ScaleRightCurve = 0 // -lin
+		}
+	}
+
+	return voice
+}
+
+// Randoms makes count random voices from a seed, the same seed always gives the
+// same voices. They are numbered after their family, like "PAD 01".
+func Randoms(seed int64, count int, options RandomOptions) []parse.Voice {
+	rng := rand.New(rand.NewSource(seed))
+
+	voices := make([]parse.Voice, count)
+	for i := range voices {
+		voices[i] = Random(rng, options)
+		voices[i].Name = fmt.Sprintf("%s %02d", voices[i].Name, i+1)
+	}
+
+	return voices
+}
+
+// NewSeed picks a seed from the clock, kept short so it can be read off and typed
+// back in to get the same voices again.
+func NewSeed() int64 {
+	return time.Now().UnixNano()%999999 + 1
+}
+
+// pick returns a random value in s.
+func pick(rng *rand.Rand, s span) byte {
+	return byte(s[0] + rng.Intn(s[1]-s[0]+1))
+}
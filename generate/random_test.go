@@ -0,0 +1,79 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRandomsSameSeed(t *testing.T) {
+	for _, options := range []RandomOptions{{}, {Family: "bell"}, {Family: "pad", Algorithm: 32}} {
+		a, b := Randoms(1234, 32, options), Randoms(1234, 32, options)
+		for i := range a {
+			if a[i].Name != b[i].Name || !bytes.Equal(a[i].Unpacked(), b[i].Unpacked()) {
+				t.Errorf("%+v: voice %d differs between two runs with the same seed", options, i+1)
+			}
+		}
+
+		other := Randoms(1235, 32, options)
+		same := 0
+		for i := range a {
+			if bytes.Equal(a[i].Unpacked(), other[i].Unpacked()) {
+				same++
+			}
+		}
+		if same == len(a) {
+			t.Errorf("%+v: another seed gave the same voices", options)
+		}
+	}
+}
+
+func TestRandomsInRange(t *testing.T) {
+	for _, family := range append([]string{""}, Families...) {
+		for seed := int64(1); seed <= 5; seed++ {
+			options := RandomOptions{Family: family}
+			voices := Randoms(seed, 32, options)
+			checkRanges(t, fmt.Sprintf("family [%s] seed %d", family, seed), voices...)
+
+			for i, voice := range voices {
+				if family != "" && voice.Name != fmt.Sprintf("%s %02d", strings.ToUpper(family), i+1) {
+					t.Errorf("family [%s] voice %d is named [%s]", family, i+1, voice.Name)
+				}
+				if len(voice.Name) > 10 {
+					t.Errorf("[%s] is longer than the 10 characters a voice name has", voice.Name)
+				}
+			}
+		}
+	}
+
+	for algorithm := 1; algorithm <= 32; algorithm++ {
+		for _, voice := range Randoms(int64(algorithm), 4, RandomOptions{Algorithm: algorithm}) {
+			if int(voice.Algorithm)+1 != algorithm {
+				t.Errorf("asked for algorithm %d, got %d", algorithm, voice.Algorithm+1)
+			}
+			checkRanges(t, fmt.Sprintf("algorithm %d", algorithm), voice)
+		}
+	}
+}
+
+func TestRandomOptionsCheck(t *testing.T) {
+	for _, options := range []RandomOptions{{}, {Family: "bass"}, {Algorithm: 1}, {Family: "lead", Algorithm: 32}} {
+		if err := options.Check(); err != nil {
+			t.Errorf("%+v: %s", options, err)
+		}
+	}
+	for _, options := range []RandomOptions{{Family: "choir"}, {Algorithm: 33}, {Algorithm: -1}} {
+		if err := options.Check(); err == nil {
+			t.Errorf("%+v gave no error", options)
+		}
+	}
+}
+
+func TestNewSeed(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if seed := NewSeed(); seed < 1 || seed > 999999 {
+			t.Fatalf("NewSeed() = %d, want 1 - 999999", seed)
+		}
+	}
+}
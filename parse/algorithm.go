@@ -0,0 +1,72 @@
+package parse
+
+// Algorithm describes how the six operators of one of the 32 DX7 algorithms are
+// connected. Operators are numbered 1 - 6 like on the synth's front panel, and
+// always modulate lower numbered operators.
+type Algorithm struct {
+	// Modulators lists, for OP1 - OP6 (index 0 - 5), the operators that modulate it.
+	Modulators [6][]int
+	// Carriers are the operators heard at the output.
+	Carriers []int
+	// The output of the Feedback operator is fed back into FeedbackTo, which is
+	// the same operator except in algorithms 4 and 6.
+	Feedback   int
+	FeedbackTo int
+}
+
+// Algorithms holds algorithm 1 - 32 at index 0 - 31, the same as Voice.Algorithm.
+var Algorithms = [32]Algorithm{
+	{Modulators: [6][]int{{2}, nil, {4}, {5}, {6}, nil}, Carriers: []int{1, 3}, Feedback: 6, FeedbackTo: 6},
+	{Modulators: [6][]int{{2}, nil, {4}, {5}, {6}, nil}, Carriers: []int{1, 3}, Feedback: 2, FeedbackTo: 2},
+	{Modulators: [6][]int{{2}, {3}, nil, {5}, {6}, nil}, Carriers: []int{1, 4}, Feedback: 6, FeedbackTo: 6},
+	{Modulators: [6][]int{{2}, {3}, nil, {5}, {6}, nil}, Carriers: []int{1, 4}, Feedback: 4, FeedbackTo: 6},
+	{Modulators: [6][]int{{2}, nil, {4}, nil, {6}, nil}, Carriers: []int{1, 3, 5}, Feedback: 6, FeedbackTo: 6},
+	{Modulators: [6][]int{{2}, nil, {4}, nil, {6}, nil}, Carriers: []int{1, 3, 5}, Feedback: 5, FeedbackTo: 6},
+	{Modulators: [6][]int{{2}, nil, {4, 5}, nil, {6}, nil}, Carriers: []int{1, 3}, Feedback: 6, FeedbackTo: 6},
+	{Modulators: [6][]int{{2}, nil, {4, 5}, nil, {6}, nil}, Carriers: []int{1, 3}, Feedback: 4, FeedbackTo: 4},
+	{Modulators: [6][]int{{2}, nil, {4, 5}, nil, {6}, nil}, Carriers: []int{1, 3}, Feedback: 2, FeedbackTo: 2},
+	{Modulators: [6][]int{{2}, {3}, nil, {5, 6}, nil, nil}, Carriers: []int{1, 4}, Feedback: 3, FeedbackTo: 3},
+	{Modulators: [6][]int{{2}, {3}, nil, {5, 6}, nil, nil}, Carriers: []int{1, 4}, Feedback: 6, FeedbackTo: 6},
+	{Modulators: [6][]int{{2}, nil, {4, 5, 6}, nil, nil, nil}, Carriers: []int{1, 3}, Feedback: 2, FeedbackTo: 2},
+	{Modulators: [6][]int{{2}, nil, {4, 5, 6}, nil, nil, nil}, Carriers: []int{1, 3}, Feedback: 6, FeedbackTo: 6},
+	{Modulators: [6][]int{{2}, nil, {4}, {5, 6}, nil, nil}, Carriers: []int{1, 3}, Feedback: 6, FeedbackTo: 6},
+	{Modulators: [6][]int{{2}, nil, {4}, {5, 6}, nil, nil}, Carriers: []int{1, 3}, Feedback: 2, FeedbackTo: 2},
+	{Modulators: [6][]int{{2, 3, 5}, nil, {4}, nil, {6}, nil}, Carriers: []int{1}, Feedback: 6, FeedbackTo: 6},
+	{Modulators: [6][]int{{2, 3, 5}, nil, {4}, nil, {6}, nil}, Carriers: []int{1}, Feedback: 2, FeedbackTo: 2},
+	{Modulators: [6][]int{{2, 3, 4}, nil, nil, {5}, {6}, nil}, Carriers: []int{1}, Feedback: 3, FeedbackTo: 3},
+	{Modulators: [6][]int{{2}, {3}, nil, {6}, {6}, nil}, Carriers: []int{1, 4, 5}, Feedback: 6, FeedbackTo: 6},
+	{Modulators: [6][]int{{3}, {3}, nil, {5, 6}, nil, nil}, Carriers: []int{1, 2, 4}, Feedback: 3, FeedbackTo: 3},
+	{Modulators: [6][]int{{3}, {3}, nil, {6}, {6}, nil}, Carriers: []int{1, 2, 4, 5}, Feedback: 3, FeedbackTo: 3},
+	{Modulators: [6][]int{{2}, nil, {6}, {6}, {6}, nil}, Carriers: []int{1, 3, 4, 5}, Feedback: 6, FeedbackTo: 6},
+	{Modulators: [6][]int{nil, {3}, nil, {6}, {6}, nil}, Carriers: []int{1, 2, 4, 5}, Feedback: 6, FeedbackTo: 6},
+	{Modulators: [6][]int{nil, nil, {6}, {6}, {6}, nil}, Carriers: []int{1, 2, 3, 4, 5}, Feedback: 6, FeedbackTo: 6},
+	{Modulators: [6][]int{nil, nil, nil, {6}, {6}, nil}, Carriers: []int{1, 2, 3, 4, 5}, Feedback: 6, FeedbackTo: 6},
+	{Modulators: [6][]int{nil, {3}, nil, {5, 6}, nil, nil}, Carriers: []int{1, 2, 4}, Feedback: 6, FeedbackTo: 6},
+	{Modulators: [6][]int{nil, {3}, nil, {5, 6}, nil, nil}, Carriers: []int{1, 2, 4}, Feedback: 3, FeedbackTo: 3},
+	{Modulators: [6][]int{{2}, nil, {4}, {5}, nil, nil}, Carriers: []int{1, 3, 6}, Feedback: 5, FeedbackTo: 5},
+	{Modulators: [6][]int{nil, nil, {4}, nil, {6}, nil}, Carriers: []int{1, 2, 3, 5}, Feedback: 6, FeedbackTo: 6},
+	{Modulators: [6][]int{nil, nil, {4}, {5}, nil, nil}, Carriers: []int{1, 2, 3, 6}, Feedback: 5, FeedbackTo: 5},
+	{Modulators: [6][]int{nil, nil, nil, nil, {6}, nil}, Carriers: []int{1, 2, 3, 4, 5}, Feedback: 6, FeedbackTo: 6},
+	{Modulators: [6][]int{nil, nil, nil, nil, nil, nil}, Carriers: []int{1, 2, 3, 4, 5, 6}, Feedback: 6, FeedbackTo: 6},
+}
+
+// IsCarrier reports whether operator 1 - 6 is heard at the output.
+func (a Algorithm) IsCarrier(op int) bool {
+	for _, carrier := range a.Carriers {
+		if carrier == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Topology returns how the operators of the voice are connected.
+func (voice Voice) Topology() Algorithm {
+	return Algorithms[voice.Algorithm%32]
+}
+
+// Operator returns operator 1 - 6 as numbered on the synth. Sysex, and so the
+// Operators slice, stores them in reverse: Operators[0] is OP6.
+func (voice Voice) Operator(op int) Operator {
+	return voice.Operators[6-op]
+}
@@ -0,0 +1,184 @@
+package parse
+
+import (
+	"os"
+	"strings"
+)
+
+// InitVoice returns the DX7 "INIT VOICE", used to fill empty bank slots.
+func InitVoice() Voice {
+	voice := Voice{
+		Operators:     make([]Operator, 6),
+		PitchEGRate1:  99,
+		PitchEGRate2:  99,
+		PitchEGRate3:  99,
+		PitchEGRate4:  99,
+		PitchEGLevel1: 50,
+		PitchEGLevel2: 50,
+		PitchEGLevel3: 50,
+		PitchEGLevel4: 50,
+		OscKeySync:    1,
+		LfoSpeed:      35,
+		LfoSync:       1,
+
+		LfoPitchModSensitivity: 3,
+
+		Transpose: 24,
+		Name:      "INIT VOICE",
+	}
+
+	for i := range voice.Operators {
+		voice.Operators[i] = Operator{
+			EGRate1: 99, EGRate2: 99, EGRate3: 99, EGRate4: 99,
+			EGLevel1: 99, EGLevel2: 99, EGLevel3: 99, EGLevel4: 0,
+			LevelScalingBreakPoint: 39,
+			Detune:                 7,
+			FrequencyCoarse:        1,
+		}
+	}
+
+	// Only OP1, the last operator in sysex order, is audible
+	voice.Operators[5].OutputLevel = 99
+
+	return voice
+}
+
+// Unpacked returns the 155 byte single voice (VCED) form of the voice.
+func (voice Voice) Unpacked() []byte {
+	data := make([]byte, 0, 155)
+
+	for _, oper := range voice.Operators {
+		data = append(data, []byte{
+			oper.EGRate1, oper.EGRate2, oper.EGRate3, oper.EGRate4, oper.EGLevel1, oper.EGLevel2, oper.EGLevel3, oper.EGLevel4,
+			oper.LevelScalingBreakPoint, oper.ScaleLeftDepth, oper.ScaleRightDepth, oper.ScaleLeftCurve, oper.ScaleRightCurve,
+			oper.RateScale, oper.AmplitudeModulationSensitivity, oper.KeyVelocitySensitivity, oper.OutputLevel, oper.OscillatorMode,
+			oper.FrequencyCoarse, oper.FrequencyFine, oper.Detune}...)
+	}
+
+	data = append(data, []byte{
+		voice.PitchEGRate1, voice.PitchEGRate2, voice.PitchEGRate3, voice.PitchEGRate4,
+		voice.PitchEGLevel1, voice.PitchEGLevel2, voice.PitchEGLevel3, voice.PitchEGLevel4,
+		voice.Algorithm, voice.Feedback, voice.OscKeySync, voice.LfoSpeed, voice.LfoDelay,
+		voice.LfoPitchModDepth, voice.LfoAMDepth, voice.LfoSync, voice.LfoWave, voice.LfoPitchModSensitivity,
+		voice.Transpose}...)
+
+	return append(data, voiceName(voice.Name)...)
+}
+
+// Packed returns the 128 byte bulk (VMEM) form of the voice, as stored in a 32 voice bank.
+func (voice Voice) Packed() []byte {
+	data := make([]byte, 0, 128)
+
+	for _, oper := range voice.Operators {
+		data = append(data, []byte{
+			oper.EGRate1, oper.EGRate2, oper.EGRate3, oper.EGRate4, oper.EGLevel1, oper.EGLevel2, oper.EGLevel3, oper.EGLevel4,
+			oper.LevelScalingBreakPoint, oper.ScaleLeftDepth, oper.ScaleRightDepth,
+			(oper.ScaleRightCurve&0x3)<<2 | oper.ScaleLeftCurve&0x3,
+			(oper.Detune&0xF)<<3 | oper.RateScale&0x7,
+			(oper.KeyVelocitySensitivity&0x7)<<2 | oper.AmplitudeModulationSensitivity&0x3,
+			oper.OutputLevel,
+			(oper.FrequencyCoarse&0x1F)<<1 | oper.OscillatorMode&0x1,
+			oper.FrequencyFine}...)
+	}
+
+	data = append(data, []byte{
+		voice.PitchEGRate1, voice.PitchEGRate2, voice.PitchEGRate3, voice.PitchEGRate4,
+		voice.PitchEGLevel1, voice.PitchEGLevel2, voice.PitchEGLevel3, voice.PitchEGLevel4,
+		voice.Algorithm,
+		(voice.OscKeySync&0x1)<<3 | voice.Feedback&0x7,
+		voice.LfoSpeed, voice.LfoDelay, voice.LfoPitchModDepth, voice.LfoAMDepth,
+		(voice.LfoPitchModSensitivity&0x7)<<4 | (voice.LfoWave&0x7)<<1 | voice.LfoSync&0x1,
+		voice.Transpose}...)
+
+	return append(data, voiceName(voice.Name)...)
+}
+
+// VoiceSysex packages a voice as a single voice sysex message for the edit buffer.
+func VoiceSysex(voice Voice) []byte {
+	return VCEDSysex(voice.Unpacked())
+}
+
+// BankSysex packages up to 32 voices as a bank sysex message, empty slots get the INIT VOICE.
+func BankSysex(voices []Voice) []byte {
+	data := make([]byte, 0, CartridgeSize)
+
+	for i := 0; i < 32; i++ {
+		voice := InitVoice()
+		if i < len(voices) && len(voices[i].Operators) == 6 {
+			voice = voices[i]
+		}
+		data = append(data, voice.Packed()...)
+	}
+
+	return CartridgeSysex(data)
+}
+
+// VCEDSysex puts the sysex header and checksum around 155 bytes of single voice data.
+func VCEDSysex(data []byte) []byte {
+	sysex := []byte{0xF0, 0x43, 0x00, 0x00, 0x01, 0x1B} // data1 - data155 --- checksum, 0xF7
+
+	sysex = append(sysex, data...)
+
+	return append(sysex, Checksum(data), 0xF7)
+}
+
+// CartridgeSysex puts the sysex header and checksum around a headerless 32 voice bank.
+func CartridgeSysex(data []byte) []byte {
+	sysex := []byte{0xF0, 0x43, 0x00, 0x09, 0x20, 0x00} // data1 - data4096 --- checksum, 0xF7
+
+	sysex = append(sysex, data...)
+
+	return append(sysex, Checksum(data), 0xF7)
+}
+
+// ParameterChange changes one parameter of the voice in the edit buffer, numbered
+// like the bytes of the single voice (VCED) data.
+func ParameterChange(parameter int, value byte) []byte {
+	return []byte{0xF0, 0x43, 0x10, byte(parameter>>7) & 0x03, byte(parameter) & 0x7F, value & 0x7F, 0xF7}
+}
+
+// ParameterChanges lists the parameter changes that turn voice from into voice to.
+// When the voices don't line up parameter for parameter, or the changes would take
+// more bytes than the whole voice, it is the whole voice instead.
+func ParameterChanges(from Voice, to Voice) [][]byte {
+	var changes [][]byte
+
+	whole := VoiceSysex(to)
+	a, b := from.Unpacked(), to.Unpacked()
+	if len(a) != len(b) {
+		return [][]byte{whole}
+	}
+
+	size := 0
+	for i := range b {
+		if a[i] != b[i] {
+			change := ParameterChange(i, b[i])
+			if size += len(change); size >= len(whole) {
+				return [][]byte{whole}
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	return changes
+}
+
+// WriteBank saves up to 32 voices as a bank sysex file.
+func WriteBank(fileName string, voices []Voice) error {
+	return os.WriteFile(fileName, BankSysex(voices), 0644)
+}
+
+// voiceName pads or cuts a name to the 10 ASCII characters a voice has room for.
+func voiceName(name string) []byte {
+	if len(name) > 10 {
+		name = name[:10]
+	}
+	name += strings.Repeat(" ", 10-len(name))
+
+	data := []byte(name)
+	for i := range data {
+		data[i] &= 0x7F
+	}
+
+	return data
+}
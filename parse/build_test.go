@@ -0,0 +1,88 @@
+package parse
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParameterChange(t *testing.T) {
+	tests := []struct {
+		parameter int
+		value     byte
+		want      []byte
+	}{
+		{0, 99, []byte{0xF0, 0x43, 0x10, 0x00, 0x00, 0x63, 0xF7}},
+		{16, 50, []byte{0xF0, 0x43, 0x10, 0x00, 0x10, 0x32, 0xF7}},
+		{127, 1, []byte{0xF0, 0x43, 0x10, 0x00, 0x7F, 0x01, 0xF7}},
+		{128, 31, []byte{0xF0, 0x43, 0x10, 0x01, 0x00, 0x1F, 0xF7}},
+		{134, 4, []byte{0xF0, 0x43, 0x10, 0x01, 0x06, 0x04, 0xF7}},
+		{155, 'Z', []byte{0xF0, 0x43, 0x10, 0x01, 0x1B, 0x5A, 0xF7}},
+	}
+
+	for _, test := range tests {
+		if got := ParameterChange(test.parameter, test.value); !bytes.Equal(got, test.want) {
+			t.Errorf("ParameterChange(%d, %d) = % X, want % X", test.parameter, test.value, got, test.want)
+		}
+	}
+}
+
+func TestParameterChanges(t *testing.T) {
+	from := InitVoice()
+
+	to := InitVoice()
+	to.Operators[5].OutputLevel = 80 // OP1, stored last
+	to.Algorithm = 4
+	to.Name = "INIT VOICF"
+
+	want := [][]byte{
+		ParameterChange(5*21+16, 80),
+		ParameterChange(134, 4),
+		ParameterChange(154, 'F'),
+	}
+	changes := ParameterChanges(from, to)
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d", len(changes), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(changes[i], want[i]) {
+			t.Errorf("change %d is % X, want % X", i, changes[i], want[i])
+		}
+	}
+
+	if changes := ParameterChanges(from, from); len(changes) != 0 {
+		t.Errorf("%d changes between a voice and itself", len(changes))
+	}
+}
+
+func TestParameterChangesWholeVoice(t *testing.T) {
+	from := InitVoice()
+	whole := VoiceSysex(InitVoice())
+
+	// A change is 7 bytes and a voice 163, so 23 changes are still smaller
+	for count, wantWhole := range map[int]bool{23: false, 24: true, 6 * 21: true} {
+		data := from.Unpacked()
+		for i := 0; i < count; i++ {
+			data[i] ^= 1
+		}
+		bank, err := New(VCEDSysex(data))
+		if err != nil || len(bank.Voices) != 1 {
+			t.Fatalf("reading back %d changed parameters: %v", count, err)
+		}
+		to := bank.Voices[0]
+
+		changes := ParameterChanges(from, to)
+		if wantWhole {
+			if len(changes) != 1 || !bytes.Equal(changes[0], VoiceSysex(to)) {
+				t.Errorf("%d differences gave %d messages, want the whole voice", count, len(changes))
+			}
+		} else if len(changes) != count {
+			t.Errorf("%d differences gave %d messages, want a change for each", count, len(changes))
+		}
+	}
+
+	// A voice without its operators can't be changed parameter by parameter
+	empty := Voice{Name: "EMPTY"}
+	if changes := ParameterChanges(empty, from); len(changes) != 1 || !bytes.Equal(changes[0], whole) {
+		t.Errorf("a voice without operators gave %d changes, want the whole voice", len(changes))
+	}
+}
@@ -0,0 +1,214 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dexed keeps its cartridges as plain 32 voice .syx files, which OpenDir already
+// reads. Its plugin state, what a DAW saves in a session, is a small XML document
+// holding the cartridge and the voice being edited as JUCE flavored base64:
+//
+//	<dexedState currentProgram="0" ...>
+//	  <dexedBlob sysex="base64:4104.xxx" program="base64:161.xxx"/>
+//	</dexedState>
+//
+// Hosts store that XML behind an 8 byte JUCE header, the chunk.
+
+// CartridgeSize is a headerless 32 voice bank, as some editors save them.
+const CartridgeSize = 4096
+
+// dexedChunkMagic starts JUCE binary plugin state, "VC2!" little endian.
+const dexedChunkMagic = 0x21324356
+
+type dexedState struct {
+	XMLName        xml.Name  `xml:"dexedState"`
+	Cutoff         string    `xml:"cutoff,attr"`
+	Reso           string    `xml:"reso,attr"`
+	Gain           string    `xml:"gain,attr"`
+	CurrentProgram int       `xml:"currentProgram,attr"`
+	MonoMode       string    `xml:"monoMode,attr"`
+	EngineType     string    `xml:"engineType,attr"`
+	MasterTune     string    `xml:"masterTune,attr"`
+	OpSwitch       string    `xml:"opSwitch,attr"`
+	Blob           dexedBlob `xml:"dexedBlob"`
+}
+
+type dexedBlob struct {
+	Sysex   string `xml:"sysex,attr"`
+	Program string `xml:"program,attr"`
+}
+
+// IsDexedState tells if data looks like Dexed plugin state, as XML or a JUCE chunk.
+func IsDexedState(data []byte) bool {
+	if len(data) >= 8 && binary.LittleEndian.Uint32(data) == dexedChunkMagic {
+		return true
+	}
+	if len(data) > 512 {
+		data = data[:512]
+	}
+	return bytes.Contains(data, []byte("<dexedState"))
+}
+
+// DexedState packs up to 32 voices into Dexed plugin state XML, with the first voice selected.
+func DexedState(voices []Voice) ([]byte, error) {
+	if len(voices) > 32 {
+		return nil, fmt.Errorf("a Dexed cartridge holds 32 voices, got %d", len(voices))
+	}
+	if len(voices) == 0 {
+		return nil, errors.New("no voices to export")
+	}
+
+	// The program is the edit buffer: the voice plus Dexed's six operator on/off switches
+	program := append(voices[0].Unpacked(), 1, 1, 1, 1, 1, 1)
+
+	state := dexedState{
+		Cutoff:     "1",
+		Reso:       "0",
+		Gain:       "1",
+		MonoMode:   "0",
+		EngineType: "1",
+		MasterTune: "0",
+		OpSwitch:   "111111",
+		Blob: dexedBlob{
+			Sysex:   "base64:" + juceBase64(BankSysex(voices)),
+			Program: "base64:" + juceBase64(program),
+		},
+	}
+
+	data, err := xml.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// DexedChunk wraps Dexed plugin state the way a host stores it.
+func DexedChunk(voices []Voice) ([]byte, error) {
+	state, err := DexedState(voices)
+	if err != nil {
+		return nil, err
+	}
+
+	chunk := make([]byte, 8, 8+len(state)+1)
+	binary.LittleEndian.PutUint32(chunk, dexedChunkMagic)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(state)))
+	chunk = append(chunk, state...)
+
+	return append(chunk, 0), nil
+}
+
+// ImportDexed reads the cartridge out of Dexed plugin state. The voice being edited
+// replaces its slot, since that is what was playing in the session.
+func ImportDexed(data []byte) ([]Voice, error) {
+	if len(data) >= 8 && binary.LittleEndian.Uint32(data) == dexedChunkMagic {
+		size := int(binary.LittleEndian.Uint32(data[4:]))
+		if size > len(data)-8 {
+			return nil, errors.New("truncated Dexed state")
+		}
+		data = bytes.TrimRight(data[8:8+size], "\x00")
+	}
+
+	var state dexedState
+	if err := xml.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("reading Dexed state: %s", err)
+	}
+
+	cart, err := juceBase64Decode(state.Blob.Sysex)
+	if err != nil {
+		return nil, fmt.Errorf("reading Dexed cartridge: %s", err)
+	}
+	if len(cart) == CartridgeSize {
+		cart = CartridgeSysex(cart)
+	}
+
+	bank, err := New(cart)
+	if err != nil {
+		return nil, err
+	}
+	if len(bank.Voices) != 32 {
+		return nil, errors.New("Dexed state has no cartridge")
+	}
+
+	if state.Blob.Program != "" {
+		program, err := juceBase64Decode(state.Blob.Program)
+		if err != nil {
+			return nil, fmt.Errorf("reading Dexed program: %s", err)
+		}
+		if len(program) >= 155 && state.CurrentProgram >= 0 && state.CurrentProgram < 32 {
+			edit, err := New(VCEDSysex(program[:155]))
+			if err == nil && len(edit.Voices) == 1 {
+				bank.Voices[state.CurrentProgram] = edit.Voices[0]
+			}
+		}
+	}
+
+	return bank.Voices, nil
+}
+
+// JUCE's MemoryBlock base64 is its own: the byte count, a dot, then the data as a
+// little endian bit stream, six bits a character from its own alphabet.
+const juceBase64Chars = ".ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+"
+
+func juceBase64(data []byte) string {
+	var out strings.Builder
+	out.WriteString(strconv.Itoa(len(data)))
+	out.WriteByte('.')
+
+	acc, bits := uint32(0), uint(0)
+	for _, b := range data {
+		acc |= uint32(b) << bits
+		bits += 8
+		for bits >= 6 {
+			out.WriteByte(juceBase64Chars[acc&0x3F])
+			acc >>= 6
+			bits -= 6
+		}
+	}
+	if bits > 0 {
+		out.WriteByte(juceBase64Chars[acc&0x3F])
+	}
+
+	return out.String()
+}
+
+func juceBase64Decode(s string) ([]byte, error) {
+	s = strings.TrimPrefix(s, "base64:")
+
+	dot := strings.IndexByte(s, '.')
+	if dot < 0 {
+		return nil, errors.New("not JUCE base64")
+	}
+	size, err := strconv.Atoi(s[:dot])
+	if err != nil || size < 0 {
+		return nil, errors.New("not JUCE base64")
+	}
+
+	data := make([]byte, 0, size)
+	acc, bits := uint32(0), uint(0)
+	for _, c := range s[dot+1:] {
+		value := strings.IndexRune(juceBase64Chars, c)
+		if value < 0 {
+			continue
+		}
+		acc |= uint32(value) << bits
+		bits += 6
+		if bits >= 8 {
+			data = append(data, byte(acc))
+			acc >>= 8
+			bits -= 8
+		}
+	}
+
+	if len(data) < size {
+		return nil, fmt.Errorf("expected %d bytes, got %d", size, len(data))
+	}
+
+	return data[:size], nil
+}
@@ -0,0 +1,142 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestJuceBase64(t *testing.T) {
+	data := []byte{0x00, 0xFF, 0x12, 0x80, 0x7F}
+
+	for n := 0; n <= len(data); n++ {
+		encoded := juceBase64(data[:n])
+
+		// The byte count comes first, then six bits a character, rounded up
+		if prefix := strings.SplitN(encoded, ".", 2); len(prefix) != 2 || prefix[0] != strconv.Itoa(n) || len(prefix[1]) != (n*8+5)/6 {
+			t.Errorf("juceBase64 of %d bytes gave %q", n, encoded)
+		}
+
+		decoded, err := juceBase64Decode("base64:" + encoded)
+		if err != nil {
+			t.Errorf("decoding %d bytes %q: %s", n, encoded, err)
+			continue
+		}
+		if !bytes.Equal(decoded, data[:n]) {
+			t.Errorf("%d bytes came back as % x, want % x", n, decoded, data[:n])
+		}
+	}
+
+	// Lowest bits first, so a one byte is an A then a dot for the two bits left
+	if got := juceBase64([]byte{1}); got != "1.A." {
+		t.Errorf("juceBase64(01) = %q, want %q", got, "1.A.")
+	}
+}
+
+func TestJuceBase64DecodeErrors(t *testing.T) {
+	for _, s := range []string{"", "AAAA", "x.AAAA", "-1.AA", "4.AA"} {
+		if data, err := juceBase64Decode(s); err == nil {
+			t.Errorf("juceBase64Decode(%q) = % x, want an error", s, data)
+		}
+	}
+}
+
+func TestImportDexed(t *testing.T) {
+	bank, _, err := Open("../sysex/DX7_AllTheWeb/Godric/piano10.syx", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := DexedState(bank.Voices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk, err := DexedChunk(bank.Voices)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{"state": state, "chunk": chunk} {
+		if !IsDexedState(data) {
+			t.Errorf("%s: not recognized as Dexed state", name)
+		}
+
+		voices, err := ImportDexed(data)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if len(voices) != 32 {
+			t.Errorf("%s: got %d voices, want 32", name, len(voices))
+			continue
+		}
+		for i := range voices {
+			if !bytes.Equal(voices[i].Unpacked(), bank.Voices[i].Unpacked()) {
+				t.Errorf("%s: voice %d [%s] changed on the way through", name, i+1, bank.Voices[i].Name)
+			}
+		}
+	}
+}
+
+func TestImportDexedProgram(t *testing.T) {
+	cart := make([]Voice, 32)
+	for i := range cart {
+		cart[i] = InitVoice()
+	}
+	state, err := DexedState(cart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The voice being edited in slot 4 replaces what the cartridge holds there
+	edit := InitVoice()
+	edit.Name = "EDITED    "
+	edit.Algorithm = 12
+	program := "base64:" + juceBase64(append(edit.Unpacked(), 1, 1, 1, 1, 1, 1))
+
+	xml := strings.Replace(string(state), `currentProgram="0"`, `currentProgram="3"`, 1)
+	xml = strings.Replace(xml, `program="base64:`, `program="`+program+`" old="`, 1)
+
+	voices, err := ImportDexed([]byte(xml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(voices[3].Unpacked(), edit.Unpacked()) {
+		t.Errorf("slot 4 is [%s], want the edited voice", voices[3].Name)
+	}
+	if !bytes.Equal(voices[0].Unpacked(), InitVoice().Unpacked()) {
+		t.Errorf("slot 1 is [%s], want the INIT VOICE", voices[0].Name)
+	}
+}
+
+func TestImportDexedErrors(t *testing.T) {
+	chunk, err := DexedChunk([]Voice{InitVoice()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	badMagic := append([]byte{}, chunk...)
+	binary.LittleEndian.PutUint32(badMagic, 0x21324357)
+
+	short := append([]byte{}, chunk[:len(chunk)/2]...)
+
+	noCart := []byte(`<dexedState currentProgram="0"><dexedBlob sysex="base64:3.AAAA" program=""/></dexedState>`)
+
+	for name, data := range map[string][]byte{
+		"bad magic":    badMagic,
+		"short chunk":  short,
+		"header only":  chunk[:8],
+		"no cartridge": noCart,
+		"not xml":      []byte("VC2"),
+	} {
+		if voices, err := ImportDexed(data); err == nil {
+			t.Errorf("%s: got %d voices, want an error", name, len(voices))
+		}
+	}
+
+	if IsDexedState(badMagic[:8]) {
+		t.Error("a chunk with a bad magic number is recognized as Dexed state")
+	}
+}
@@ -0,0 +1,247 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Diagram layout: every operator is a box like [1* 99 1.00], its number, a * for
+// carriers, its output level and its ratio, or F and the frequency in Hz when fixed.
+// Modulators sit above the operators they modulate, carriers join at OUT, and the
+// feedback loop runs up the right side of its box.
+const (
+	boxWidth    = 12
+	columnWidth = boxWidth + 1
+)
+
+// line bits of a diagram cell
+const (
+	up = 1 << iota
+	down
+	left
+	right
+)
+
+var boxLines = map[int]rune{
+	up: '│', down: '│', up | down: '│', left: '─', right: '─', left | right: '─',
+	down | right: '┌', down | left: '┐', up | right: '└', up | left: '┘',
+	up | down | right: '├', up | down | left: '┤', down | left | right: '┬', up | left | right: '┴',
+	up | down | left | right: '┼',
+}
+
+var asciiLines = map[rune]rune{
+	'│': '|', '─': '-', '┌': '+', '┐': '+', '└': '+', '┘': '+', '├': '+', '┤': '+', '┬': '+', '┴': '+', '┼': '+',
+}
+
+// Diagram draws the voice's algorithm, with plain ASCII lines if ascii is set.
+func (voice Voice) Diagram(ascii bool) []string {
+	if len(voice.Operators) != 6 {
+		return nil
+	}
+	a := voice.Topology()
+
+	targets := [7][]int{}
+	for op := 1; op <= 6; op++ {
+		for _, m := range a.Modulators[op-1] {
+			targets[m] = append(targets[m], op)
+		}
+	}
+
+	// Depth counts up from the carriers at 0
+	depth := [7]int{}
+	var measure func(op int) int
+	measure = func(op int) int {
+		d := 0
+		for _, t := range targets[op] {
+			if td := measure(t) + 1; td > d {
+				d = td
+			}
+		}
+		return d
+	}
+	rows := 0
+	for op := 1; op <= 6; op++ {
+		depth[op] = measure(op)
+		if depth[op]+1 > rows {
+			rows = depth[op] + 1
+		}
+	}
+
+	// Columns go left to right through the carriers, each over its stack of
+	// modulators. A modulator of several operators is centered over them.
+	x := [7]int{}
+	placed := [7]bool{}
+	column := 0
+	var place func(op int)
+	place = func(op int) {
+		first := true
+		for _, m := range a.Modulators[op-1] {
+			if len(targets[m]) > 1 {
+				continue
+			}
+			place(m)
+			if first {
+				x[op], first = x[m], false
+			}
+		}
+		if first {
+			x[op] = column*columnWidth + boxWidth/2
+			column++
+		}
+		placed[op] = true
+	}
+	for _, c := range a.Carriers {
+		place(c)
+	}
+	for op := 6; op >= 1; op-- {
+		if !placed[op] {
+			sum := 0
+			for _, t := range targets[op] {
+				sum += x[t]
+			}
+			x[op] = sum / len(targets[op])
+		}
+	}
+
+	// A line above every row of boxes, then two for the way out
+	width := column*columnWidth + 2
+	height := 2*rows + 2
+	bits := make([][]int, height)
+	text := make([][]rune, height)
+	for i := range bits {
+		bits[i] = make([]int, width)
+		text[i] = make([]rune, width)
+	}
+	boxLine := func(op int) int {
+		return 2*(rows-1-depth[op]) + 1
+	}
+
+	join := func(line int, from []int, to []int) {
+		lo, hi := width, 0
+		for _, f := range from {
+			bits[line][f] |= up
+			lo, hi = minInt(lo, f), maxInt(hi, f)
+		}
+		for _, t := range to {
+			bits[line][t] |= down
+			lo, hi = minInt(lo, t), maxInt(hi, t)
+		}
+		for i := lo; i <= hi; i++ {
+			if i > lo {
+				bits[line][i] |= left
+			}
+			if i < hi {
+				bits[line][i] |= right
+			}
+		}
+	}
+
+	// Modulation, grouped by the operators being modulated
+	for op := 1; op <= 6; op++ {
+		mods := a.Modulators[op-1]
+		if len(mods) == 0 || len(targets[mods[0]]) > 1 {
+			continue
+		}
+		from := []int{}
+		for _, m := range mods {
+			from = append(from, x[m])
+		}
+		join(boxLine(op)-1, from, []int{x[op]})
+	}
+	for op := 1; op <= 6; op++ {
+		if len(targets[op]) > 1 {
+			to := []int{}
+			for _, t := range targets[op] {
+				to = append(to, x[t])
+			}
+			join(boxLine(targets[op][0])-1, []int{x[op]}, to)
+		}
+	}
+
+	// Carriers to OUT
+	from, sum := []int{}, 0
+	for _, c := range a.Carriers {
+		from = append(from, x[c])
+		sum += x[c]
+	}
+	out := sum / len(a.Carriers)
+	join(height-2, from, []int{out})
+	copy(text[height-1][out-1:], []rune("OUT"))
+
+	// Feedback, from the right of the feedback box up and over into the top of the
+	// operator it goes back into
+	fb := maxInt(x[a.Feedback], x[a.FeedbackTo]) - boxWidth/2 + boxWidth
+	top, bottom := boxLine(a.FeedbackTo)-1, boxLine(a.Feedback)
+	join(top, nil, []int{x[a.FeedbackTo], fb})
+	bits[top][fb] = left | down
+	for line := top + 1; line < bottom; line++ {
+		bits[line][fb] |= up | down
+	}
+	bits[bottom][fb] = up | left
+
+	// The boxes
+	for op := 1; op <= 6; op++ {
+		o := voice.Operator(op)
+		mark := ' '
+		if a.IsCarrier(op) {
+			mark = '*'
+		}
+		box := fmt.Sprintf("[%d%c %2d %4s]", op, mark, o.OutputLevel%100, diagramFrequency(o))
+		copy(text[boxLine(op)][x[op]-boxWidth/2:], []rune(box))
+	}
+
+	lines := make([]string, 0, height+1)
+	for i := range text {
+		line := make([]rune, width)
+		for j := range line {
+			switch {
+			case text[i][j] != 0:
+				line[j] = text[i][j]
+			case bits[i][j] != 0:
+				line[j] = boxLines[bits[i][j]]
+				if ascii {
+					line[j] = asciiLines[line[j]]
+				}
+			default:
+				line[j] = ' '
+			}
+		}
+		lines = append(lines, strings.TrimRight(string(line), " "))
+	}
+
+	return append(lines, fmt.Sprintf("Algorithm %d, feedback %d   * carrier, level, ratio or F fixed Hz", voice.Algorithm%32+1, voice.Feedback))
+}
+
+// diagramFrequency fits an operator's ratio, or fixed frequency, in four characters.
+func diagramFrequency(o Operator) string {
+	if o.OscillatorMode == 1 {
+		hz := o.FixedFrequency()
+		switch {
+		case hz < 10:
+			return fmt.Sprintf("F%.1f", hz)
+		case hz < 1000:
+			return fmt.Sprintf("F%.0f", hz)
+		}
+		return fmt.Sprintf("F%.0fk", hz/1000)
+	}
+
+	ratio := o.Ratio()
+	if ratio < 10 {
+		return fmt.Sprintf("%.2f", ratio)
+	}
+	return fmt.Sprintf("%.1f", ratio)
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
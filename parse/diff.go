@@ -0,0 +1,53 @@
+package parse
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Difference is one parameter that differs between two voices, with both values
+// shown as the synth would.
+type Difference struct {
+	Field string // like "Algorithm" or "OP3 EGRate2"
+	A     string
+	B     string
+}
+
+// Diff lists every parameter that differs between two voices, the voice settings
+// first and then operator by operator, OP1 - OP6.
+func Diff(a Voice, b Voice) []Difference {
+	var diffs []Difference
+
+	compare := func(prefix string, va reflect.Value, vb reflect.Value) {
+		for i := 0; i < va.NumField(); i++ {
+			name := va.Type().Field(i).Name
+			if name == "Operators" || name == "BankFileName" {
+				continue
+			}
+			x, y := fmt.Sprint(va.Field(i).Interface()), fmt.Sprint(vb.Field(i).Interface())
+			if a, ok := va.Field(i).Interface().(byte); ok {
+				x, y = ParameterText(name, a), ParameterText(name, vb.Field(i).Interface().(byte))
+			}
+			if x != y {
+				diffs = append(diffs, Difference{Field: prefix + name, A: x, B: y})
+			}
+		}
+	}
+
+	compare("", reflect.ValueOf(a), reflect.ValueOf(b))
+
+	if len(a.Operators) != 6 || len(b.Operators) != 6 {
+		return diffs
+	}
+	for op := 1; op <= 6; op++ {
+		compare(fmt.Sprintf("OP%d ", op), reflect.ValueOf(a.Operator(op)), reflect.ValueOf(b.Operator(op)))
+	}
+
+	return diffs
+}
+
+// ParameterCount is how many parameters Diff compares.
+func ParameterCount() int {
+	// Everything but Operators and BankFileName, plus six operators
+	return reflect.TypeOf(Voice{}).NumField() - 2 + 6*reflect.TypeOf(Operator{}).NumField()
+}
@@ -0,0 +1,73 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a := InitVoice()
+	b := InitVoice()
+
+	b.Algorithm = 4
+	b.LfoWave = 1
+	b.Transpose = 36
+	b.Name = "BRASS     "
+	b.BankFileName = "other.syx"
+	b.Operators[5].OutputLevel = 80           // OP1
+	b.Operators[5].OscillatorMode = 1         // OP1
+	b.Operators[4].ScaleLeftCurve = 3         // OP2
+	b.Operators[0].Detune = 3                 // OP6
+	b.Operators[0].LevelScalingBreakPoint = 0 // OP6
+
+	want := []Difference{
+		{"Algorithm", "1", "5"},
+		{"LfoWave", "TRIANGLE", "SAW DOWN"},
+		{"Transpose", "C3", "C4"},
+		{"Name", "INIT VOICE", "BRASS     "},
+		{"OP1 OutputLevel", "99", "80"},
+		{"OP1 OscillatorMode", "RATIO", "FIXED"},
+		{"OP2 ScaleLeftCurve", "-LIN", "+LIN"},
+		{"OP6 LevelScalingBreakPoint", "C3", "A-1"},
+		{"OP6 Detune", "0", "-4"},
+	}
+
+	if got := Diff(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff gave\n%v\nwant\n%v", got, want)
+	}
+	if got := Diff(a, a); len(got) != 0 {
+		t.Errorf("a voice differs from itself: %v", got)
+	}
+
+	// The other way around swaps the values
+	for i, d := range Diff(b, a) {
+		if d.Field != want[i].Field || d.A != want[i].B || d.B != want[i].A {
+			t.Errorf("Diff(b, a)[%d] = %v, want %v swapped", i, d, want[i])
+		}
+	}
+}
+
+func TestDiffEveryParameter(t *testing.T) {
+	a := InitVoice()
+	b := Voice{Operators: make([]Operator, 6), Name: "EVERYTHING"}
+	for i := range b.Operators {
+		b.Operators[i] = Operator{
+			EGRate1: 1, EGRate2: 1, EGRate3: 1, EGRate4: 1, EGLevel1: 1, EGLevel2: 1, EGLevel3: 1, EGLevel4: 1,
+			LevelScalingBreakPoint: 1, ScaleLeftDepth: 1, ScaleRightDepth: 1, ScaleLeftCurve: 1, ScaleRightCurve: 1,
+			RateScale: 1, Detune: 1, AmplitudeModulationSensitivity: 1, KeyVelocitySensitivity: 1, OutputLevel: 1,
+			OscillatorMode: 1, FrequencyCoarse: 2, FrequencyFine: 1,
+		}
+	}
+	b.PitchEGRate1, b.PitchEGRate2, b.PitchEGRate3, b.PitchEGRate4 = 1, 1, 1, 1
+	b.PitchEGLevel1, b.PitchEGLevel2, b.PitchEGLevel3, b.PitchEGLevel4 = 1, 1, 1, 1
+	b.Algorithm, b.Feedback, b.OscKeySync = 1, 1, 0
+	b.LfoSpeed, b.LfoDelay, b.LfoPitchModDepth, b.LfoAMDepth, b.LfoSync, b.LfoWave = 1, 1, 1, 1, 0, 1
+	b.LfoPitchModSensitivity, b.Transpose = 1, 1
+
+	if got, want := len(Diff(a, b)), ParameterCount(); got != want {
+		t.Errorf("%d parameters differ, want all %d", got, want)
+	}
+	if ParameterCount() != 146 {
+		t.Errorf("ParameterCount() = %d, want 20 voice and 6 x 21 operator parameters", ParameterCount())
+	}
+}
@@ -0,0 +1,125 @@
+package parse
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Parameters as the synth's display shows them, shared by the voice listings, the
+// TUI, diffs and exports.
+
+// noteNames are the twelve notes of an octave.
+var noteNames = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// Ratio is the operator's frequency as a multiple of the note played, in ratio mode.
+func (o Operator) Ratio() float64 {
+	ratio := float64(o.FrequencyCoarse)
+	if ratio == 0 {
+		ratio = 0.5
+	}
+	return ratio * (1 + float64(o.FrequencyFine)/100)
+}
+
+// FixedFrequency is the operator's frequency in Hz in fixed mode: 1, 10, 100 or
+// 1000Hz, times up to 9.772.
+func (o Operator) FixedFrequency() float64 {
+	return math.Pow(10, float64(o.FrequencyCoarse&3)) * math.Pow(10, float64(o.FrequencyFine)/100)
+}
+
+// FrequencyText shows the ratio, like "1.41", or the fixed frequency to four
+// digits, like "316.2 Hz".
+func (o Operator) FrequencyText() string {
+	if o.OscillatorMode != 1 {
+		return fmt.Sprintf("%.2f", o.Ratio())
+	}
+
+	hz := o.FixedFrequency()
+	switch {
+	case hz < 10:
+		return fmt.Sprintf("%.3f Hz", hz)
+	case hz < 100:
+		return fmt.Sprintf("%.2f Hz", hz)
+	case hz < 1000:
+		return fmt.Sprintf("%.1f Hz", hz)
+	}
+	return fmt.Sprintf("%.0f Hz", hz)
+}
+
+// DetuneOffset turns a detune of 0 - 14 into -7 - +7.
+func DetuneOffset(detune byte) int {
+	return int(detune) - 7
+}
+
+// DetuneText shows a detune as -7 - +7.
+func DetuneText(detune byte) string {
+	if offset := DetuneOffset(detune); offset != 0 {
+		return fmt.Sprintf("%+d", offset)
+	}
+	return "0"
+}
+
+// CurveText shows a keyboard level scaling curve, like "-LIN".
+func CurveText(curve byte) string {
+	return strings.ToUpper(enumName(Curves, curve))
+}
+
+// LfoWaveText shows an LFO wave, like "SAW DOWN".
+func LfoWaveText(wave byte) string {
+	return strings.ToUpper(strings.Replace(enumName(LfoWaves, wave), "_", " ", -1))
+}
+
+// ModeText shows an oscillator mode, RATIO or FIXED.
+func ModeText(mode byte) string {
+	return strings.ToUpper(enumName(OscillatorModes, mode))
+}
+
+// OnOff shows a switch.
+func OnOff(value byte) string {
+	if value == 0 {
+		return "OFF"
+	}
+	return "ON"
+}
+
+// NoteName names a MIDI note the way the DX7 does, with middle C as C3.
+func NoteName(note int) string {
+	if note < 0 {
+		return fmt.Sprintf("%d", note)
+	}
+	return fmt.Sprintf("%s%d", noteNames[note%12], note/12-2)
+}
+
+// BreakPointText shows a level scaling break point 0 - 99 as A-1 - C8.
+func BreakPointText(breakPoint byte) string {
+	return NoteName(int(breakPoint) + 21)
+}
+
+// TransposeText shows a transpose 0 - 48 as C1 - C5, C3 is none.
+func TransposeText(transpose byte) string {
+	return NoteName(int(transpose) + 36)
+}
+
+// ParameterText shows a voice or operator parameter, by its field name, the way
+// the synth would.
+func ParameterText(field string, value byte) string {
+	switch field {
+	case "Algorithm":
+		return fmt.Sprintf("%d", int(value)%32+1)
+	case "OscKeySync", "LfoSync":
+		return OnOff(value)
+	case "Transpose":
+		return TransposeText(value)
+	case "LfoWave":
+		return LfoWaveText(value)
+	case "ScaleLeftCurve", "ScaleRightCurve":
+		return CurveText(value)
+	case "LevelScalingBreakPoint":
+		return BreakPointText(value)
+	case "Detune":
+		return DetuneText(value)
+	case "OscillatorMode":
+		return ModeText(value)
+	}
+	return fmt.Sprintf("%d", value)
+}
@@ -0,0 +1,174 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Export is the document written by ExportJSON and ExportYAML.
+type Export struct {
+	Voices []VoiceDoc `json:"voices" yaml:"voices"`
+}
+
+// VoiceDoc is a voice with stable parameter names and enums spelled out, for
+// diffing patches in git and handing them to other tools. The fields ending in
+// _note, and frequency and detune_offset, repeat other values the way the synth
+// shows them. They can be left out of a file, but Import refuses them when they
+// don't agree with the values they come from, so an edit to one isn't lost.
+type VoiceDoc struct {
+	Name          string        `json:"name" yaml:"name"`
+	File          string        `json:"file,omitempty" yaml:"file,omitempty"`
+	Algorithm     int           `json:"algorithm" yaml:"algorithm"` // 1 - 32, as on the front panel
+	Feedback      int           `json:"feedback" yaml:"feedback"`
+	OscKeySync    bool          `json:"osc_key_sync" yaml:"osc_key_sync"`
+	Transpose     int           `json:"transpose" yaml:"transpose"` // 0 - 48, 24 is C3
+	TransposeNote string        `json:"transpose_note,omitempty" yaml:"transpose_note,omitempty"`
+	PitchEG       EGDoc         `json:"pitch_eg" yaml:"pitch_eg"`
+	LFO           LFODoc        `json:"lfo" yaml:"lfo"`
+	Operators     []OperatorDoc `json:"operators" yaml:"operators"` // OP1 - OP6
+}
+
+// EGDoc holds the four rates and levels of an envelope.
+type EGDoc struct {
+	Rates  [4]int `json:"rates" yaml:"rates,flow"`
+	Levels [4]int `json:"levels" yaml:"levels,flow"`
+}
+
+// LFODoc holds the LFO settings of a voice.
+type LFODoc struct {
+	Wave                string `json:"wave" yaml:"wave"`
+	Speed               int    `json:"speed" yaml:"speed"`
+	Delay               int    `json:"delay" yaml:"delay"`
+	PitchModDepth       int    `json:"pitch_mod_depth" yaml:"pitch_mod_depth"`
+	AmpModDepth         int    `json:"amp_mod_depth" yaml:"amp_mod_depth"`
+	Sync                bool   `json:"sync" yaml:"sync"`
+	PitchModSensitivity int    `json:"pitch_mod_sensitivity" yaml:"pitch_mod_sensitivity"`
+}
+
+// OperatorDoc holds the settings of one operator.
+type OperatorDoc struct {
+	Op                  int           `json:"op" yaml:"op"`
+	EG                  EGDoc         `json:"eg" yaml:"eg"`
+	OutputLevel         int           `json:"output_level" yaml:"output_level"`
+	Mode                string        `json:"mode" yaml:"mode"`
+	Coarse              int           `json:"coarse" yaml:"coarse"`
+	Fine                int           `json:"fine" yaml:"fine"`
+	Frequency           string        `json:"frequency,omitempty" yaml:"frequency,omitempty"` // like "1.41" or "316.2 Hz"
+	Detune              int           `json:"detune" yaml:"detune"`                           // 0 - 14, 7 is centered
+	DetuneOffset        int           `json:"detune_offset" yaml:"detune_offset"`             // -7 - +7
+	Scaling             KeyScalingDoc `json:"key_scaling" yaml:"key_scaling"`
+	RateScaling         int           `json:"rate_scaling" yaml:"rate_scaling"`
+	AmpModSensitivity   int           `json:"amp_mod_sensitivity" yaml:"amp_mod_sensitivity"`
+	VelocitySensitivity int           `json:"velocity_sensitivity" yaml:"velocity_sensitivity"`
+}
+
+// KeyScalingDoc holds the keyboard level scaling of an operator.
+type KeyScalingDoc struct {
+	BreakPoint     int    `json:"break_point" yaml:"break_point"` // 0 - 99, 39 is C3
+	BreakPointNote string `json:"break_point_note,omitempty" yaml:"break_point_note,omitempty"`
+	LeftDepth      int    `json:"left_depth" yaml:"left_depth"`
+	RightDepth     int    `json:"right_depth" yaml:"right_depth"`
+	LeftCurve      string `json:"left_curve" yaml:"left_curve"`
+	RightCurve     string `json:"right_curve" yaml:"right_curve"`
+}
+
+// Doc returns the export form of the voice.
+func (voice Voice) Doc() VoiceDoc {
+	doc := VoiceDoc{
+		Name:          voice.Name,
+		File:          voice.BankFileName,
+		Algorithm:     int(voice.Algorithm) + 1,
+		Feedback:      int(voice.Feedback),
+		OscKeySync:    voice.OscKeySync == 1,
+		Transpose:     int(voice.Transpose),
+		TransposeNote: TransposeText(voice.Transpose),
+		PitchEG: EGDoc{
+			Rates:  [4]int{int(voice.PitchEGRate1), int(voice.PitchEGRate2), int(voice.PitchEGRate3), int(voice.PitchEGRate4)},
+			Levels: [4]int{int(voice.PitchEGLevel1), int(voice.PitchEGLevel2), int(voice.PitchEGLevel3), int(voice.PitchEGLevel4)},
+		},
+		LFO: LFODoc{
+			Wave:                enumName(LfoWaves, voice.LfoWave),
+			Speed:               int(voice.LfoSpeed),
+			Delay:               int(voice.LfoDelay),
+			PitchModDepth:       int(voice.LfoPitchModDepth),
+			AmpModDepth:         int(voice.LfoAMDepth),
+			Sync:                voice.LfoSync == 1,
+			PitchModSensitivity: int(voice.LfoPitchModSensitivity),
+		},
+	}
+
+	if len(voice.Operators) != 6 {
+		return doc
+	}
+
+	for op := 1; op <= 6; op++ {
+		o := voice.Operator(op)
+		doc.Operators = append(doc.Operators, OperatorDoc{
+			Op: op,
+			EG: EGDoc{
+				Rates:  [4]int{int(o.EGRate1), int(o.EGRate2), int(o.EGRate3), int(o.EGRate4)},
+				Levels: [4]int{int(o.EGLevel1), int(o.EGLevel2), int(o.EGLevel3), int(o.EGLevel4)},
+			},
+			OutputLevel:  int(o.OutputLevel),
+			Mode:         enumName(OscillatorModes, o.OscillatorMode),
+			Coarse:       int(o.FrequencyCoarse),
+			Fine:         int(o.FrequencyFine),
+			Frequency:    o.FrequencyText(),
+			Detune:       int(o.Detune),
+			DetuneOffset: DetuneOffset(o.Detune),
+			Scaling: KeyScalingDoc{
+				BreakPoint:     int(o.LevelScalingBreakPoint),
+				BreakPointNote: BreakPointText(o.LevelScalingBreakPoint),
+				LeftDepth:      int(o.ScaleLeftDepth),
+				RightDepth:     int(o.ScaleRightDepth),
+				LeftCurve:      enumName(Curves, o.ScaleLeftCurve),
+				RightCurve:     enumName(Curves, o.ScaleRightCurve),
+			},
+			RateScaling:         int(o.RateScale),
+			AmpModSensitivity:   int(o.AmplitudeModulationSensitivity),
+			VelocitySensitivity: int(o.KeyVelocitySensitivity),
+		})
+	}
+
+	return doc
+}
+
+// NewExport collects the export form of the voices.
+func NewExport(voices []Voice) Export {
+	export := Export{Voices: make([]VoiceDoc, len(voices))}
+	for i, voice := range voices {
+		export.Voices[i] = voice.Doc()
+	}
+	return export
+}
+
+// ExportJSON returns the voices as indented JSON.
+func ExportJSON(voices []Voice) ([]byte, error) {
+	data, err := json.MarshalIndent(NewExport(voices), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	// Names can hold DEL, the DX7's arrow, which JSON leaves alone but YAML and so Import refuse
+	data = bytes.ReplaceAll(data, []byte{0x7F}, []byte(`\u007f`))
+
+	return append(data, '\n'), nil
+}
+
+// ExportYAML returns the voices as YAML.
+func ExportYAML(voices []Voice) ([]byte, error) {
+	var buf bytes.Buffer
+
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(NewExport(voices)); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
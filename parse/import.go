@@ -0,0 +1,277 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FieldError is a bad value in an imported voice file.
+type FieldError struct {
+	Line    int
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Field, e.Message)
+}
+
+// ImportErrors collects every problem found in a file, not just the first.
+type ImportErrors []*FieldError
+
+func (e ImportErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Import reads voices written by ExportJSON or ExportYAML, or by hand. Every value is
+// checked against the range the synth accepts and problems are reported by line and field.
+func Import(data []byte) ([]Voice, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	var export Export
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&export); err != nil {
+		return nil, err
+	}
+
+	v := &validator{root: &root}
+	if len(export.Voices) == 0 {
+		v.fail("there are no voices", "voices")
+	}
+
+	voices := make([]Voice, len(export.Voices))
+	for i, doc := range export.Voices {
+		voices[i] = v.voice(doc, "voices", i)
+	}
+
+	if len(v.errs) > 0 {
+		return nil, v.errs
+	}
+
+	return voices, nil
+}
+
+// validator turns documents back into voices, collecting what is out of range.
+type validator struct {
+	root *yaml.Node
+	errs ImportErrors
+}
+
+func (v *validator) voice(doc VoiceDoc, path ...interface{}) Voice {
+	at := func(more ...interface{}) []interface{} {
+		return append(append([]interface{}{}, path...), more...)
+	}
+	errs := len(v.errs)
+
+	voice := Voice{
+		Name:       v.name(doc.Name, at("name")...),
+		Algorithm:  v.number(doc.Algorithm, 1, 32, at("algorithm")...) - 1,
+		Feedback:   v.number(doc.Feedback, 0, 7, at("feedback")...),
+		OscKeySync: flag(doc.OscKeySync),
+		Transpose:  v.number(doc.Transpose, 0, 48, at("transpose")...),
+
+		LfoWave:                v.enum(doc.LFO.Wave, LfoWaves, at("lfo", "wave")...),
+		LfoSpeed:               v.number(doc.LFO.Speed, 0, 99, at("lfo", "speed")...),
+		LfoDelay:               v.number(doc.LFO.Delay, 0, 99, at("lfo", "delay")...),
+		LfoPitchModDepth:       v.number(doc.LFO.PitchModDepth, 0, 99, at("lfo", "pitch_mod_depth")...),
+		LfoAMDepth:             v.number(doc.LFO.AmpModDepth, 0, 99, at("lfo", "amp_mod_depth")...),
+		LfoSync:                flag(doc.LFO.Sync),
+		LfoPitchModSensitivity: v.number(doc.LFO.PitchModSensitivity, 0, 7, at("lfo", "pitch_mod_sensitivity")...),
+	}
+
+	rates, levels := v.eg(doc.PitchEG, at("pitch_eg")...)
+	voice.PitchEGRate1, voice.PitchEGRate2, voice.PitchEGRate3, voice.PitchEGRate4 = rates[0], rates[1], rates[2], rates[3]
+	voice.PitchEGLevel1, voice.PitchEGLevel2, voice.PitchEGLevel3, voice.PitchEGLevel4 = levels[0], levels[1], levels[2], levels[3]
+
+	if len(v.errs) == errs {
+		v.derived(doc.TransposeNote, TransposeText(voice.Transpose), at("transpose_note")...)
+	}
+
+	if len(doc.Operators) != 6 {
+		v.fail(fmt.Sprintf("a voice needs 6 operators, got %d", len(doc.Operators)), at("operators")...)
+		return voice
+	}
+
+	// Operators are stored OP6 first
+	voice.Operators = make([]Operator, 6)
+	seen := make(map[int]bool)
+	for i, od := range doc.Operators {
+		op := od.Op
+		if op == 0 {
+			op = i + 1
+		}
+		if op < 1 || op > 6 || seen[op] {
+			v.fail(fmt.Sprintf("op must be 1 - 6 and appear once, got %d", od.Op), at("operators", i, "op")...)
+			continue
+		}
+		seen[op] = true
+
+		voice.Operators[6-op] = v.operator(od, at("operators", i)...)
+	}
+
+	return voice
+}
+
+func (v *validator) operator(doc OperatorDoc, path ...interface{}) Operator {
+	at := func(more ...interface{}) []interface{} {
+		return append(append([]interface{}{}, path...), more...)
+	}
+	errs := len(v.errs)
+
+	o := Operator{
+		OutputLevel:     v.number(doc.OutputLevel, 0, 99, at("output_level")...),
+		OscillatorMode:  v.enum(doc.Mode, OscillatorModes, at("mode")...),
+		FrequencyCoarse: v.number(doc.Coarse, 0, 31, at("coarse")...),
+		FrequencyFine:   v.number(doc.Fine, 0, 99, at("fine")...),
+		Detune:          v.number(doc.Detune, 0, 14, at("detune")...),
+
+		LevelScalingBreakPoint: v.number(doc.Scaling.BreakPoint, 0, 99, at("key_scaling", "break_point")...),
+		ScaleLeftDepth:         v.number(doc.Scaling.LeftDepth, 0, 99, at("key_scaling", "left_depth")...),
+		ScaleRightDepth:        v.number(doc.Scaling.RightDepth, 0, 99, at("key_scaling", "right_depth")...),
+		ScaleLeftCurve:         v.enum(doc.Scaling.LeftCurve, Curves, at("key_scaling", "left_curve")...),
+		ScaleRightCurve:        v.enum(doc.Scaling.RightCurve, Curves, at("key_scaling", "right_curve")...),
+
+		RateScale:                      v.number(doc.RateScaling, 0, 7, at("rate_scaling")...),
+		AmplitudeModulationSensitivity: v.number(doc.AmpModSensitivity, 0, 3, at("amp_mod_sensitivity")...),
+		KeyVelocitySensitivity:         v.number(doc.VelocitySensitivity, 0, 7, at("velocity_sensitivity")...),
+	}
+
+	rates, levels := v.eg(doc.EG, at("eg")...)
+	o.EGRate1, o.EGRate2, o.EGRate3, o.EGRate4 = rates[0], rates[1], rates[2], rates[3]
+	o.EGLevel1, o.EGLevel2, o.EGLevel3, o.EGLevel4 = levels[0], levels[1], levels[2], levels[3]
+
+	// The values shown the synth's way only mean something when the ones they come from are good
+	if len(v.errs) == errs {
+		v.derived(doc.Frequency, o.FrequencyText(), at("frequency")...)
+		v.derived(strconv.Itoa(doc.DetuneOffset), strconv.Itoa(DetuneOffset(o.Detune)), at("detune_offset")...)
+		v.derived(doc.Scaling.BreakPointNote, BreakPointText(o.LevelScalingBreakPoint), at("key_scaling", "break_point_note")...)
+	}
+
+	return o
+}
+
+func (v *validator) eg(doc EGDoc, path ...interface{}) (rates [4]byte, levels [4]byte) {
+	for i := range rates {
+		rates[i] = v.number(doc.Rates[i], 0, 99, append(append([]interface{}{}, path...), "rates", i)...)
+		levels[i] = v.number(doc.Levels[i], 0, 99, append(append([]interface{}{}, path...), "levels", i)...)
+	}
+	return
+}
+
+func (v *validator) number(value int, min int, max int, path ...interface{}) byte {
+	if value < min || value > max {
+		v.fail(fmt.Sprintf("must be %d - %d, got %d", min, max, value), path...)
+		return byte(min)
+	}
+	return byte(value)
+}
+
+func (v *validator) enum(value string, names []string, path ...interface{}) byte {
+	for i, name := range names {
+		if strings.EqualFold(value, name) {
+			return byte(i)
+		}
+	}
+	v.fail(fmt.Sprintf("must be one of %s, got [%s]", strings.Join(names, ", "), value), path...)
+	return 0
+}
+
+// derived checks a field that repeats other values the way the synth shows them,
+// when the file has it. An edit there would be lost, so it has to agree.
+func (v *validator) derived(value string, want string, path ...interface{}) {
+	if _, found := v.lookup(path...); found && value != want {
+		v.fail(fmt.Sprintf("is shown from the other settings and must be [%s] for them, got [%s], change those instead", want, value), path...)
+	}
+}
+
+func (v *validator) name(value string, path ...interface{}) string {
+	if len(value) > 10 {
+		v.fail(fmt.Sprintf("names have room for 10 characters, got %d", len(value)), path...)
+	}
+	// Banks use the odd control character too, the synth takes any 7 bit value
+	for _, r := range value {
+		if r > 0x7F {
+			v.fail(fmt.Sprintf("names can only use 7 bit ASCII, got [%s]", value), path...)
+			break
+		}
+	}
+	return value
+}
+
+func (v *validator) fail(message string, path ...interface{}) {
+	v.errs = append(v.errs, &FieldError{Line: v.line(path...), Field: fieldName(path...), Message: message})
+}
+
+// line finds where a field is in the file, or the closest enclosing field when it was left out.
+func (v *validator) line(path ...interface{}) int {
+	node, _ := v.lookup(path...)
+	return node.Line
+}
+
+// lookup finds a field in the file, or the closest enclosing field and false when it was left out.
+func (v *validator) lookup(path ...interface{}) (*yaml.Node, bool) {
+	node := v.root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	for _, step := range path {
+		var next *yaml.Node
+		switch key := step.(type) {
+		case string:
+			if node.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(node.Content); i += 2 {
+					if node.Content[i].Value == key {
+						next = node.Content[i+1]
+					}
+				}
+			}
+		case int:
+			if node.Kind == yaml.SequenceNode && key < len(node.Content) {
+				next = node.Content[key]
+			}
+		}
+		if next == nil {
+			return node, false
+		}
+		node = next
+	}
+
+	return node, true
+}
+
+// fieldName writes a path like voices[0].operators[2].eg.rates[1].
+func fieldName(path ...interface{}) string {
+	name := ""
+	for _, step := range path {
+		switch key := step.(type) {
+		case string:
+			if name != "" {
+				name += "."
+			}
+			name += key
+		case int:
+			name += fmt.Sprintf("[%d]", key)
+		}
+	}
+	return name
+}
+
+func flag(on bool) byte {
+	if on {
+		return 1
+	}
+	return 0
+}
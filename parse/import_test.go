@@ -0,0 +1,211 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// exportedVoices are the INIT VOICE, one named with the DX7's arrow, and a bank from
+// the library with control characters in some of its names.
+func exportedVoices(t *testing.T) []Voice {
+	bank, _, err := Open("../sysex/DX7_AllTheWeb/Godric/piano10.syx", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arrow := InitVoice()
+	arrow.Name = "UP \x7f DOWN"
+
+	return append([]Voice{InitVoice(), arrow}, bank.Voices...)
+}
+
+func TestImportExported(t *testing.T) {
+	voices := exportedVoices(t)
+
+	for _, format := range []struct {
+		name   string
+		export func([]Voice) ([]byte, error)
+	}{
+		{"JSON", ExportJSON},
+		{"YAML", ExportYAML},
+	} {
+		data, err := format.export(voices)
+		if err != nil {
+			t.Fatalf("%s: %v", format.name, err)
+		}
+
+		imported, err := Import(data)
+		if err != nil {
+			t.Fatalf("%s: importing the export failed: %v", format.name, err)
+		}
+		if len(imported) != len(voices) {
+			t.Fatalf("%s: imported %d voices, expected %d", format.name, len(imported), len(voices))
+		}
+
+		for i := range voices {
+			if !bytes.Equal(imported[i].Unpacked(), voices[i].Unpacked()) {
+				t.Errorf("%s: voice %d [%s] changed on the way through", format.name, i, voices[i].Name)
+			}
+		}
+	}
+}
+
+func TestImportFieldErrors(t *testing.T) {
+	export := NewExport([]Voice{InitVoice(), InitVoice()})
+	export.Voices[1].Feedback = 77
+	export.Voices[1].LFO.Wave = "WOBBLE"
+	export.Voices[1].Operators[2].OutputLevel = 120
+	export.Voices[1].Operators[5].EG.Rates[1] = -5
+
+	// Each bad value appears nowhere else in the file, so its line is easy to find
+	expect := []struct {
+		field string
+		value string
+	}{
+		{"voices[1].feedback", "77"},
+		{"voices[1].lfo.wave", "WOBBLE"},
+		{"voices[1].operators[2].output_level", "120"},
+		{"voices[1].operators[5].eg.rates[1]", "-5"},
+	}
+
+	for _, format := range []struct {
+		name   string
+		encode func(interface{}) ([]byte, error)
+	}{
+		{"JSON", func(v interface{}) ([]byte, error) { return json.MarshalIndent(v, "", "  ") }},
+		{"YAML", yaml.Marshal},
+	} {
+		data, err := format.encode(export)
+		if err != nil {
+			t.Fatalf("%s: %v", format.name, err)
+		}
+
+		_, err = Import(data)
+
+		var errs ImportErrors
+		if !errors.As(err, &errs) {
+			t.Fatalf("%s: got %v, expected ImportErrors", format.name, err)
+		}
+		if len(errs) != len(expect) {
+			t.Fatalf("%s: got %d errors, expected %d:\n%v", format.name, len(errs), len(expect), errs)
+		}
+
+		for i, e := range expect {
+			if errs[i].Field != e.field {
+				t.Errorf("%s: error %d is for %s, expected %s", format.name, i, errs[i].Field, e.field)
+			}
+			if line := lineOf(data, e.value); errs[i].Line != line {
+				t.Errorf("%s: %s reported on line %d, expected line %d", format.name, e.field, errs[i].Line, line)
+			}
+		}
+	}
+}
+
+// lineOf returns the line number of the first line holding value.
+func lineOf(data []byte, value string) int {
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.Contains(line, value) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func TestImportDerivedFields(t *testing.T) {
+	export := NewExport([]Voice{InitVoice(), InitVoice()})
+	export.Voices[1].TransposeNote = "C4"
+	export.Voices[1].Operators[0].Frequency = "2.00"
+	export.Voices[1].Operators[3].DetuneOffset = -3
+	export.Voices[1].Operators[4].Scaling.BreakPointNote = "G#7"
+
+	// A bad value is reported by itself, not again by what is shown from it
+	export.Voices[0].Operators[1].Coarse = 40
+
+	expect := []struct {
+		field string
+		value string
+	}{
+		{"voices[0].operators[1].coarse", "40"},
+		{"voices[1].transpose_note", "C4"},
+		{"voices[1].operators[0].frequency", "2.00"},
+		{"voices[1].operators[3].detune_offset", "-3"},
+		{"voices[1].operators[4].key_scaling.break_point_note", "G#7"},
+	}
+
+	for _, format := range []struct {
+		name   string
+		encode func(interface{}) ([]byte, error)
+	}{
+		{"JSON", func(v interface{}) ([]byte, error) { return json.MarshalIndent(v, "", "  ") }},
+		{"YAML", yaml.Marshal},
+	} {
+		data, err := format.encode(export)
+		if err != nil {
+			t.Fatalf("%s: %v", format.name, err)
+		}
+
+		_, err = Import(data)
+
+		var errs ImportErrors
+		if !errors.As(err, &errs) {
+			t.Fatalf("%s: got %v, expected ImportErrors", format.name, err)
+		}
+		if len(errs) != len(expect) {
+			t.Fatalf("%s: got %d errors, expected %d:\n%v", format.name, len(errs), len(expect), errs)
+		}
+
+		for i, e := range expect {
+			if errs[i].Field != e.field {
+				t.Errorf("%s: error %d is for %s, expected %s", format.name, i, errs[i].Field, e.field)
+			}
+			if line := lineOf(data, e.value); errs[i].Line != line {
+				t.Errorf("%s: %s reported on line %d, expected line %d", format.name, e.field, errs[i].Line, line)
+			}
+		}
+	}
+}
+
+func TestImportWithoutDerivedFields(t *testing.T) {
+	doc := `
+voices:
+  - name: BY HAND
+    algorithm: 5
+    feedback: 7
+    osc_key_sync: true
+    transpose: 36
+    pitch_eg: {rates: [99, 99, 99, 99], levels: [50, 50, 50, 50]}
+    lfo: {wave: sine, speed: 35, delay: 0, pitch_mod_depth: 0, amp_mod_depth: 0, sync: false, pitch_mod_sensitivity: 3}
+    operators:
+`
+	for op := 1; op <= 6; op++ {
+		doc += fmt.Sprintf(`      - op: %d
+        eg: {rates: [99, 99, 99, 99], levels: [99, 99, 99, 0]}
+        output_level: 99
+        mode: ratio
+        coarse: %d
+        fine: 0
+        detune: 10
+        key_scaling: {break_point: 39, left_depth: 0, right_depth: 0, left_curve: -lin, right_curve: -lin}
+        rate_scaling: 0
+        amp_mod_sensitivity: 0
+        velocity_sensitivity: 0
+`, op, op)
+	}
+
+	voices, err := Import([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := voices[0].Operator(3); o.FrequencyCoarse != 3 || o.Detune != 10 {
+		t.Errorf("OP3 imported as %+v", o)
+	}
+	if voices[0].Transpose != 36 {
+		t.Errorf("transpose imported as %d", voices[0].Transpose)
+	}
+}
@@ -0,0 +1,18 @@
+package parse
+
+import "fmt"
+
+// Names for the enumerated voice parameters, as exported and shown on the synth.
+var (
+	LfoWaves        = []string{"triangle", "saw_down", "saw_up", "square", "sine", "sample_hold"}
+	Curves          = []string{"-lin", "-exp", "+exp", "+lin"}
+	OscillatorModes = []string{"ratio", "fixed"}
+)
+
+// enumName looks a value up in one of the name tables, values outside it keep their number.
+func enumName(names []string, value byte) string {
+	if int(value) < len(names) {
+		return names[value]
+	}
+	return fmt.Sprintf("%d", value)
+}
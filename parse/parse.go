@@ -8,7 +8,6 @@ import (
 	"strings"
 
 	"github.com/mitchellh/hashstructure"
-	"github.com/murdinc/terminal"
 )
 
 type Library struct {
@@ -92,8 +91,13 @@ type Operator struct {
 const debug = false
 
 func OpenDir(foldername string) (Library, error) {
+	return OpenDirDedup(foldername, true)
+}
+
+// OpenDirDedup is OpenDir with a choice of whether voices that were already seen are skipped.
+func OpenDirDedup(foldername string, dedup bool) (Library, error) {
 
-	terminal.Information("Reading sysex folder...")
+	log("Reading sysex folder...", nil)
 
 	files := []string{}
 	filepath.Walk(foldername, func(path string, f os.FileInfo, err error) error {
@@ -112,7 +116,12 @@ func OpenDir(foldername string) (Library, error) {
 		if strings.HasSuffix(strings.ToLower(file), ".syx") {
 			//log(fmt.Sprintf("Scanning File: [%s]", file.Name()), nil)
 
-			bank, bankDuplicates, err := Open(file, &hashMap)
+			bankHashMap := &hashMap
+			if !dedup {
+				bankHashMap = nil
+			}
+
+			bank, bankDuplicates, err := Open(file, bankHashMap)
 			duplicates += bankDuplicates
 
 			if err == nil {
@@ -134,6 +143,11 @@ func OpenDir(foldername string) (Library, error) {
 
 }
 
+// NewLibrary makes a library of voices that are already open, like a bred generation.
+func NewLibrary(foldername string, voices []Voice) Library {
+	return Library{voices: voices, FileCount: 1, FolderName: foldername}
+}
+
 func (l *Library) Voices() []Voice {
 
 	if len(l.SearchStr) > 0 {
@@ -169,34 +183,11 @@ func (l *Library) VoiceCount() int {
 }
 
 func (l *Library) BuildSysex(voiceIndex int) []byte {
-
-	voice := l.Voices()[voiceIndex]
-
-	sysex := []byte{0xF0, 0x43, 0x00, 0x00, 0x01, 0x1B} // data1 - data155 --- checksum, 0xF7
-
-	for _, oper := range voice.Operators {
-		sysex = append(sysex, []byte{
-			oper.EGRate1, oper.EGRate2, oper.EGRate3, oper.EGRate4, oper.EGLevel1, oper.EGLevel2, oper.EGLevel3, oper.EGLevel4,
-			oper.LevelScalingBreakPoint, oper.ScaleLeftDepth, oper.ScaleRightDepth, oper.ScaleLeftCurve, oper.ScaleRightCurve,
-			oper.RateScale, oper.AmplitudeModulationSensitivity, oper.KeyVelocitySensitivity, oper.OutputLevel, oper.OscillatorMode,
-			oper.FrequencyCoarse, oper.FrequencyFine, oper.Detune}...)
-	}
-
-	sysex = append(sysex, []byte{
-		voice.PitchEGRate1, voice.PitchEGRate2, voice.PitchEGRate3, voice.PitchEGRate4,
-		voice.PitchEGLevel1, voice.PitchEGLevel2, voice.PitchEGLevel3, voice.PitchEGLevel4,
-		voice.Algorithm, voice.Feedback, voice.OscKeySync, voice.LfoSpeed, voice.LfoDelay,
-		voice.LfoPitchModDepth, voice.LfoAMDepth, voice.LfoSync, voice.LfoWave, voice.LfoPitchModSensitivity,
-		voice.Transpose}...)
-
-	sysex = append(sysex, []byte(voice.Name)...)
-
-	sysex = append(sysex, checksum(sysex[6:]), 0xF7)
-
-	return sysex
+	return VoiceSysex(l.Voices()[voiceIndex])
 }
 
-func checksum(block []byte) byte {
+// Checksum calculates the Yamaha sysex checksum of a block of voice data.
+func Checksum(block []byte) byte {
 	crc := byte(0x00)
 	for i := 0; i < len(block); i++ {
 		crc += (block[i] & 0x7F)
@@ -244,6 +235,11 @@ func Open(fileName string, hashMap *map[uint64]string) (Bank, int, error) {
 		return Bank{}, 0, err
 	}
 
+	// Some editors save cartridges without the sysex header
+	if len(sysexFile) == CartridgeSize && sysexFile[0] != 0xF0 {
+		sysexFile = CartridgeSysex(sysexFile)
+	}
+
 	bank := Bank{Raw: sysexFile, FileName: fileName, HashMap: hashMap}
 
 	duplicates, err := bank.Parse()
@@ -268,6 +264,11 @@ func New(raw []byte) (Bank, error) {
 }
 
 func (bank *Bank) Parse() (int, error) {
+	if len(bank.Raw) < 6 {
+		// Too short for a header, there are no voices in it
+		return 0, nil
+	}
+
 	bank.Start = bank.Raw[0] //F0
 	bank.Manufacturer = bank.Raw[1]
 	bank.StatusAndChannel = bank.Raw[2]
@@ -305,7 +306,7 @@ func (bank *Bank) Parse() (int, error) {
 		//bank.Size = 4096
 
 	default:
-		terminal.ErrorLine(fmt.Sprintf("Unknown Bank Format: 0x%.2X, skipping: %v", bank.Format, bank.FileName))
+		log("Unknown Bank Format", fmt.Errorf("0x%.2X, skipping: %v", bank.Format, bank.FileName))
 		return duplicates, nil
 	}
 
@@ -358,15 +359,12 @@ func (bank *Bank) doSingleVoice() int {
 		BankFileName: bank.FileName,
 	}
 
-	voiceHash, _ := hashstructure.Hash(voice, nil)
-
-	if _, ok := (*bank.HashMap)[voiceHash]; ok {
+	if bank.isDuplicate(voice) {
 		//terminal.Notice("Duplicate found!	-	" + existingName)
 		duplicates++
 
 	} else {
 		bank.Voices[0] = voice
-		(*bank.HashMap)[voiceHash] = voice.Name
 	}
 
 	return duplicates
@@ -411,8 +409,8 @@ func (bank *Bank) doBulkVoices() int {
 			LfoAMDepth:       bank.Raw[voiceStart+115],
 
 			LfoSync:                bank.Raw[voiceStart+116] & 0x1,         // bit 0
-			LfoWave:                (bank.Raw[voiceStart+116] & 0x1E) >> 1, // bits 1 - 4
-			LfoPitchModSensitivity: (bank.Raw[voiceStart+116] & 0x60) >> 5, // bits 5 - 6
+			LfoWave:                (bank.Raw[voiceStart+116] & 0x0E) >> 1, // bits 1 - 3
+			LfoPitchModSensitivity: (bank.Raw[voiceStart+116] & 0x70) >> 4, // bits 4 - 6
 
 			Transpose: bank.Raw[voiceStart+117],
 
@@ -420,15 +418,12 @@ func (bank *Bank) doBulkVoices() int {
 			BankFileName: bank.FileName,
 		}
 
-		voiceHash, _ := hashstructure.Hash(voice, nil)
-
-		if _, ok := (*bank.HashMap)[voiceHash]; ok {
+		if bank.isDuplicate(voice) {
 			duplicates++
 			bank.Voices = bank.Voices[:len(bank.Voices)-1]
 
 		} else {
 			bank.Voices[i-duplicates] = voice
-			(*bank.HashMap)[voiceHash] = voice.Name
 		}
 
 		voiceStart += 128
@@ -438,6 +433,24 @@ func (bank *Bank) doBulkVoices() int {
 
 }
 
+// isDuplicate reports whether the voice was already seen and remembers it if not.
+// Banks without a HashMap, like dumps received from the synth, keep every voice.
+func (bank *Bank) isDuplicate(voice Voice) bool {
+	if bank.HashMap == nil {
+		return false
+	}
+
+	voiceHash, _ := hashstructure.Hash(voice, nil)
+
+	if _, ok := (*bank.HashMap)[voiceHash]; ok {
+		return true
+	}
+
+	(*bank.HashMap)[voiceHash] = voice.Name
+
+	return false
+}
+
 func doBulkOperators(raw []byte) []Operator {
 	operators := make([]Operator, 6)
 
@@ -542,21 +555,22 @@ func (bank *Bank) DisplayVoices() error {
 		log(fmt.Sprintf("[%d] Name: %v", i+1, bank.Voices[i].Name), nil)
 
 		// Start Operators
-		for n, operator := range bank.Voices[i].Operators {
-			log(fmt.Sprintf("		Operator %d", n+1), nil)
+		for op := 1; op <= 6 && len(bank.Voices[i].Operators) == 6; op++ {
+			operator := bank.Voices[i].Operator(op)
+			log(fmt.Sprintf("		Operator %d", op), nil)
 			log(fmt.Sprintf("			EGRate1: %.2d		EGLevel1: %.2d		ScaleLeftDepth:  %d", operator.EGRate1, operator.EGLevel1, operator.ScaleLeftDepth), nil)
 			log(fmt.Sprintf("			EGRate2: %.2d		EGLevel2: %.2d		ScaleRightDepth: %d", operator.EGRate2, operator.EGLevel2, operator.ScaleRightDepth), nil)
-			log(fmt.Sprintf("			EGRate3: %.2d		EGLevel3: %.2d		ScaleLeftCurve:  %d", operator.EGRate3, operator.EGLevel3, operator.ScaleLeftCurve), nil)
-			log(fmt.Sprintf("			EGRate4: %.2d		EGLevel4: %.2d		ScaleRightCurve: %d", operator.EGRate4, operator.EGLevel4, operator.ScaleRightCurve), nil)
+			log(fmt.Sprintf("			EGRate3: %.2d		EGLevel3: %.2d		ScaleLeftCurve:  %s", operator.EGRate3, operator.EGLevel3, CurveText(operator.ScaleLeftCurve)), nil)
+			log(fmt.Sprintf("			EGRate4: %.2d		EGLevel4: %.2d		ScaleRightCurve: %s", operator.EGRate4, operator.EGLevel4, CurveText(operator.ScaleRightCurve)), nil)
 			log("", nil)
 
-			log(fmt.Sprintf("			LevelScalingBreakPoint: %d			AmplitudeModulationSensitivity: %d", operator.LevelScalingBreakPoint, operator.AmplitudeModulationSensitivity), nil)
+			log(fmt.Sprintf("			LevelScalingBreakPoint: %s			AmplitudeModulationSensitivity: %d", BreakPointText(operator.LevelScalingBreakPoint), operator.AmplitudeModulationSensitivity), nil)
 			log(fmt.Sprintf("			RateScale: %d					KeyVelocitySensitivity: %d", operator.RateScale, operator.KeyVelocitySensitivity), nil)
-			log(fmt.Sprintf("			Detune: %d					OutputLevel: %d", operator.Detune, operator.OutputLevel), nil)
+			log(fmt.Sprintf("			Detune: %s					OutputLevel: %d", DetuneText(operator.Detune), operator.OutputLevel), nil)
 			log("", nil)
 
-			log(fmt.Sprintf("			FrequencyCoarse: %d				OscillatorMode: %d", operator.FrequencyCoarse, operator.OscillatorMode), nil)
-			log(fmt.Sprintf("			FrequencyFine: %d", operator.FrequencyFine), nil)
+			log(fmt.Sprintf("			Frequency: %s				OscillatorMode: %s", operator.FrequencyText(), ModeText(operator.OscillatorMode)), nil)
+			log(fmt.Sprintf("			FrequencyCoarse: %d		FrequencyFine: %d", operator.FrequencyCoarse, operator.FrequencyFine), nil)
 			log("", nil)
 		}
 		// End Operators
@@ -567,19 +581,19 @@ func (bank *Bank) DisplayVoices() error {
 		log(fmt.Sprintf("		PitchEGRate4: %.2d		PitchEGLevel4: %.2d", bank.Voices[i].PitchEGRate4, bank.Voices[i].PitchEGLevel4), nil)
 		log("", nil)
 
-		log(fmt.Sprintf("		Algorithm: %.2d			Feedback: %.2d			OscKeySync: %.2d", bank.Voices[i].Algorithm, bank.Voices[i].Feedback, bank.Voices[i].OscKeySync), nil)
+		log(fmt.Sprintf("		Algorithm: %.2d			Feedback: %.2d			OscKeySync: %s", bank.Voices[i].Algorithm%32+1, bank.Voices[i].Feedback, OnOff(bank.Voices[i].OscKeySync)), nil)
 		log("", nil)
 
 		log(fmt.Sprintf("		LfoSpeed: %.2d			LfoPitchModDepth: %.2d", bank.Voices[i].LfoSpeed, bank.Voices[i].LfoPitchModDepth), nil)
 		log(fmt.Sprintf("		LfoDelay: %.2d			LfoAMDepth: %.2d", bank.Voices[i].LfoDelay, bank.Voices[i].LfoAMDepth), nil)
 		log("", nil)
 
-		log(fmt.Sprintf("		LfoSync: %.2d", bank.Voices[i].LfoSync), nil)
-		log(fmt.Sprintf("		LfoWave: %.2d", bank.Voices[i].LfoWave), nil)
+		log(fmt.Sprintf("		LfoSync: %s", OnOff(bank.Voices[i].LfoSync)), nil)
+		log(fmt.Sprintf("		LfoWave: %s", LfoWaveText(bank.Voices[i].LfoWave)), nil)
 		log(fmt.Sprintf("		LfoPitchModSensitivity: %.2d", bank.Voices[i].LfoPitchModSensitivity), nil)
 		log("", nil)
 
-		log(fmt.Sprintf("		Transpose: %.2d", bank.Voices[i].Transpose), nil)
+		log(fmt.Sprintf("		Transpose: %s", TransposeText(bank.Voices[i].Transpose)), nil)
 		log("\n\n", nil)
 
 	}
@@ -587,7 +601,7 @@ func (bank *Bank) DisplayVoices() error {
 	log(fmt.Sprintf("Checksum: %X", bank.Checksum), nil)
 
 	dataRange := bank.Raw[6:161]
-	checkSum := checksum(dataRange)
+	checkSum := Checksum(dataRange)
 	log(fmt.Sprintf("Calculated Checksum: %X", checkSum), nil)
 	log(fmt.Sprintf("Calculated Checksum Length: %d", len(dataRange)), nil)
 
@@ -609,10 +623,11 @@ func dbg(kind string, err error) {
 	}
 }
 
+// log writes to stderr, so exports written to stdout stay clean
 func log(kind string, err error) {
 	if err == nil {
-		fmt.Printf("   %s\n", kind)
+		fmt.Fprintf(os.Stderr, "   %s\n", kind)
 	} else {
-		fmt.Printf("[ERROR - %s]: %s\n", kind, err)
+		fmt.Fprintf(os.Stderr, "[ERROR - %s]: %s\n", kind, err)
 	}
 }
@@ -0,0 +1,323 @@
+// Package preview auditions voices through the computer's speakers with the
+// software synth, so the library can be browsed without a TX7 attached.
+package preview
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+	"github.com/murdinc/MVRD_TX7_PATCHER/synth"
+)
+
+// ErrNoPlayer is returned when no audio player could be found on the system.
+var ErrNoPlayer = errors.New("No audio player found, set one with: config player \"aplay -q\"")
+
+// ErrClosed is returned when playing on a closed Preview.
+var ErrClosed = errors.New("Preview is closed")
+
+// Preview stands in for the synth, rendering every uploaded voice and playing it.
+type Preview struct {
+	// Player is the command that plays a WAV file, the file name is appended.
+	Player string
+	// Pipe, when set, receives every rendered WAV instead of the player.
+	Pipe string
+
+	Notes    []int
+	Velocity int
+	Length   time.Duration
+
+	mu      sync.Mutex
+	playing *exec.Cmd
+
+	// queued holds the latest voice waiting for the pipe, a newer one replaces it
+	queued chan queuedVoice
+	// generation counts previews, a pipe write stops when it is no longer the latest
+	generation int
+	// pipeErr is the error of the last pipe write, returned by the next Play
+	pipeErr error
+	// writing is the pipe being written, closed by Close to end a blocked write
+	writing *os.File
+	closed  bool
+}
+
+// New returns a Preview playing the notes through player, or the first player found when empty.
+func New(player string, pipe string, notes []int) (*Preview, error) {
+	if player == "" && pipe == "" {
+		player = findPlayer()
+		if player == "" {
+			return nil, ErrNoPlayer
+		}
+	}
+	if pipe == "" && strings.TrimSpace(player) == "" {
+		return nil, ErrNoPlayer
+	}
+
+	return &Preview{Player: player, Pipe: pipe, Notes: notes, Velocity: 100, Length: time.Second / 2}, nil
+}
+
+// Upload renders the voice in a single voice dump, or the first voice of a bank, and plays it.
+func (p *Preview) Upload(sysex []byte) error {
+	bank, err := parse.New(sysex)
+	if err != nil {
+		return err
+	}
+	if len(bank.Voices) == 0 {
+		return errors.New("No voice to preview")
+	}
+
+	return p.Play(bank.Voices[0])
+}
+
+// Play renders a voice and plays it, cutting off whatever was still playing. With
+// a pipe the voice is rendered and written in the background, so a slow reader
+// can't hold up the caller, and a preview still waiting or being written is dropped.
+func (p *Preview) Play(voice parse.Voice) error {
+	if p.Pipe != "" {
+		return p.queue(voice)
+	}
+
+	args := strings.Fields(p.Player)
+	if len(args) == 0 {
+		return ErrNoPlayer
+	}
+
+	samples := p.render(voice)
+
+	f, err := os.CreateTemp("", "tx7preview-*.wav")
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	if err := synth.SaveWAV(f.Name(), samples, synth.DefaultSampleRate); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	p.Stop()
+
+	args = append(args, f.Name())
+	cmd := exec.Command(args[0], args[1:]...)
+	if err := cmd.Start(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	p.mu.Lock()
+	p.playing = cmd
+	p.mu.Unlock()
+
+	go func() {
+		cmd.Wait()
+		os.Remove(f.Name())
+	}()
+
+	return nil
+}
+
+func (p *Preview) render(voice parse.Voice) []float64 {
+	return synth.RenderNotes(voice, synth.Chord(p.Notes, p.Velocity, p.Length), synth.DefaultOptions)
+}
+
+// queue hands a voice to the pipe writer in place of any that is still waiting.
+func (p *Preview) queue(voice parse.Voice) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+	if p.queued == nil {
+		p.queued = make(chan queuedVoice, 1)
+		go p.writePipe()
+	}
+
+	p.generation++
+
+	select {
+	case <-p.queued:
+	default:
+	}
+	p.queued <- queuedVoice{voice, p.generation}
+
+	err := p.pipeErr
+	p.pipeErr = nil
+	return err
+}
+
+// queuedVoice is a voice waiting for the pipe and the preview it was.
+type queuedVoice struct {
+	voice      parse.Voice
+	generation int
+}
+
+// writePipe renders queued voices and writes them to the pipe one at a time.
+func (p *Preview) writePipe() {
+	for queued := range p.queued {
+		if !p.latest(queued.generation) {
+			continue
+		}
+
+		var wav bytes.Buffer
+		if err := synth.WriteWAV(&wav, p.render(queued.voice), synth.DefaultSampleRate); err != nil {
+			p.failed(err)
+			continue
+		}
+
+		f, err := p.openPipe(queued.generation)
+		if err != nil {
+			p.failed(err)
+			continue
+		}
+		if f == nil {
+			continue
+		}
+
+		for data := wav.Bytes(); len(data) > 0 && p.latest(queued.generation); {
+			n := len(data)
+			if n > pipeChunk {
+				n = pipeChunk
+			}
+			if _, err = f.Write(data[:n]); err != nil {
+				break
+			}
+			data = data[n:]
+		}
+
+		p.mu.Lock()
+		p.writing = nil
+		p.mu.Unlock()
+
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil && p.latest(queued.generation) {
+			p.failed(err)
+		}
+	}
+}
+
+// openPipe opens the pipe for the preview generation. A named pipe can't be opened
+// until it has a reader, so it is retried until one shows up or the preview is
+// dropped, which gives a nil file.
+func (p *Preview) openPipe(generation int) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(p.Pipe, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|syscall.O_NONBLOCK, 0644)
+		if errors.Is(err, syscall.ENXIO) {
+			if !p.latest(generation) {
+				return nil, nil
+			}
+			time.Sleep(pipeRetry)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.generation != generation {
+			f.Close()
+			return nil, nil
+		}
+		p.writing = f
+		return f, nil
+	}
+}
+
+// pipeRetry is how long to wait for a named pipe to get a reader before trying again.
+const pipeRetry = 50 * time.Millisecond
+
+// pipeChunk is how much of a preview is written between checks for a newer one.
+const pipeChunk = 4096
+
+// latest reports whether no preview was played or stopped since generation.
+func (p *Preview) latest(generation int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.generation == generation
+}
+
+func (p *Preview) failed(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pipeErr = err
+}
+
+// Change plays voice to, there is no edit buffer to change.
+func (p *Preview) Change(from parse.Voice, to parse.Voice) error {
+	return p.Play(to)
+}
+
+// Stop cuts off the preview that is playing, if any.
+func (p *Preview) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Drop a preview waiting for the pipe and cut off the one being written
+	p.generation++
+	if p.queued != nil {
+		select {
+		case <-p.queued:
+		default:
+		}
+	}
+
+	if p.playing != nil && p.playing.Process != nil {
+		p.playing.Process.Kill()
+	}
+	p.playing = nil
+}
+
+// Panic stops playback, there are no notes to hang.
+func (p *Preview) Panic() error {
+	p.Stop()
+	return nil
+}
+
+// Close stops playback and the pipe writer, a write blocked on a reader that
+// stopped reading is cut off.
+func (p *Preview) Close() error {
+	p.Stop()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
+	if p.queued != nil {
+		close(p.queued)
+	}
+	if p.writing != nil {
+		p.writing.Close()
+	}
+
+	return nil
+}
+
+// findPlayer looks for a command line WAV player that usually comes with the OS.
+func findPlayer() string {
+	players := []string{"aplay -q", "paplay", "play -q", "ffplay -nodisp -autoexit -loglevel quiet"}
+	if runtime.GOOS == "darwin" {
+		players = append([]string{"afplay"}, players...)
+	}
+
+	for _, player := range players {
+		if _, err := exec.LookPath(strings.Fields(player)[0]); err == nil {
+			return player
+		}
+	}
+
+	return ""
+}
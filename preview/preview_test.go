@@ -0,0 +1,130 @@
+package preview
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+	"github.com/murdinc/MVRD_TX7_PATCHER/synth"
+)
+
+func TestNewRejectsEmptyPlayer(t *testing.T) {
+	for _, player := range []string{" ", "\t \n"} {
+		if _, err := New(player, "", []int{60}); err != ErrNoPlayer {
+			t.Errorf("New(%q) gave %v, want ErrNoPlayer", player, err)
+		}
+	}
+
+	if _, err := New(" ", filepath.Join(t.TempDir(), "out.wav"), []int{60}); err != nil {
+		t.Errorf("New with a pipe and no player: %s", err)
+	}
+}
+
+func TestPlayEmptyPlayer(t *testing.T) {
+	p := &Preview{Player: "  ", Notes: []int{60}, Velocity: 100, Length: time.Second / 20}
+	if err := p.Play(parse.InitVoice()); err != ErrNoPlayer {
+		t.Errorf("Play with an empty player gave %v, want ErrNoPlayer", err)
+	}
+}
+
+// waitForFile waits until the file holds want, the pipe is written in the background.
+func waitForFile(t *testing.T, name string, want []byte) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		got, _ := os.ReadFile(name)
+		if bytes.Equal(got, want) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s holds %d bytes, want the %d byte preview", name, len(got), len(want))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPipe(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "preview.wav")
+	p, err := New("", name, []int{60, 67})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Length = time.Second / 10
+	defer p.Close()
+
+	first := parse.InitVoice()
+	second := parse.InitVoice()
+	second.Algorithm = 31
+	second.Operators[4].OutputLevel = 99
+
+	if err := p.Play(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Play(second); err != nil {
+		t.Fatal(err)
+	}
+
+	// The newest preview replaces the one before it
+	var want bytes.Buffer
+	if err := synth.WriteWAV(&want, p.render(second), synth.DefaultSampleRate); err != nil {
+		t.Fatal(err)
+	}
+	waitForFile(t, name, want.Bytes())
+}
+
+func TestPipeError(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "missing", "preview.wav")
+	p, err := New("", name, []int{60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Length = time.Second / 20
+	defer p.Close()
+
+	if err := p.Play(parse.InitVoice()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The failed write is returned by the next Play
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		p.mu.Lock()
+		err := p.pipeErr
+		p.mu.Unlock()
+		if err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("writing to a missing folder gave no error")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := p.Play(parse.InitVoice()); err == nil {
+		t.Error("Play gave no error after a failed pipe write")
+	}
+}
+
+func TestClose(t *testing.T) {
+	p, err := New("", filepath.Join(t.TempDir(), "preview.wav"), []int{60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Length = time.Second / 20
+
+	if err := p.Play(parse.InitVoice()); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("second Close: %s", err)
+	}
+	if err := p.Play(parse.InitVoice()); err != ErrClosed {
+		t.Errorf("Play after Close gave %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,184 @@
+package synth
+
+import "math"
+
+// Envelope levels are kept in the DX7's internal log scale: 256 units per
+// doubling of amplitude, so every step of output level is 32 units, or 0.75 dB.
+
+// levelTable maps EG and output levels below 20 onto the internal scale, above
+// that each level is simply 28 more.
+var levelTable = [20]int{0, 5, 9, 13, 17, 20, 23, 25, 27, 29, 31, 33, 35, 37, 39, 41, 42, 43, 45, 46}
+
+// scaleLevel turns an EG or output level 0 - 99 into the internal 0 - 127 scale.
+func scaleLevel(level int) int {
+	if level < 0 {
+		return 0
+	}
+	if level < 20 {
+		return levelTable[level]
+	}
+	if level > 99 {
+		level = 99
+	}
+	return level + 28
+}
+
+// Envelope is one operator EG: attack to Level1 at Rate1, decay to Level2 and
+// Level3 at Rate2 and Rate3, hold Level3 while the key is down, and release
+// to Level4 at Rate4.
+type Envelope struct {
+	targets [4]float64
+	incs    [4]float64
+
+	level float64
+	stage int
+	down  bool
+}
+
+// NewEnvelope builds an EG from the voice's rates and levels. outLevel is the
+// operator's total level on the internal scale (output level, keyboard level
+// scaling and velocity), rateScaling is added to every rate.
+func NewEnvelope(rates [4]byte, levels [4]byte, outLevel int, rateScaling int, sampleRate int) *Envelope {
+	e := &Envelope{down: true}
+
+	for i := 0; i < 4; i++ {
+		target := (scaleLevel(int(levels[i]))>>1)<<6 + outLevel - 4256
+		if target < 16 {
+			target = 16
+		}
+		e.targets[i] = float64(target)
+
+		qrate := (int(rates[i])*41)>>6 + rateScaling
+		if qrate > 63 {
+			qrate = 63
+		}
+
+		// Units per sample at 44.1kHz, scaled to the render rate
+		e.incs[i] = float64(4+(qrate&3)) * math.Pow(2, float64(qrate>>2)-14) * 44100 / float64(sampleRate)
+	}
+
+	// The DX7 starts every note from Level4
+	e.level = e.targets[3]
+
+	return e
+}
+
+// Release moves the EG into its release stage.
+func (e *Envelope) Release() {
+	e.down = false
+	e.stage = 3
+}
+
+// Next advances the EG by one sample and returns its level on the internal scale.
+func (e *Envelope) Next() float64 {
+	target := e.targets[e.stage]
+	inc := e.incs[e.stage]
+
+	if e.level < target {
+		// Attacks jump past the inaudible bottom and slow down as they get loud
+		if e.level < 1716 {
+			e.level = 1716
+		}
+		e.level += math.Floor(17-e.level/256) * inc
+		if e.level >= target {
+			e.level = target
+			e.advance()
+		}
+	} else if e.level > target {
+		e.level -= inc
+		if e.level <= target {
+			e.level = target
+			e.advance()
+		}
+	} else {
+		e.advance()
+	}
+
+	return e.level
+}
+
+// Done reports whether the EG has released and settled.
+func (e *Envelope) Done() bool {
+	return !e.down && e.level == e.targets[3]
+}
+
+func (e *Envelope) advance() {
+	// Level3 is held while the key is down, Level4 after release
+	if e.down && e.stage < 2 {
+		e.stage++
+	}
+}
+
+// gain turns a level on the internal scale into an amplitude, 2.0 at the top.
+func gain(level float64) float64 {
+	return math.Exp2(level/256 - 14)
+}
+
+// PitchEnvelope bends the pitch of every operator in ratio mode. Level 50 is
+// no change, 0 and 99 are four octaves down and up.
+type PitchEnvelope struct {
+	targets [4]float64
+	incs    [4]float64
+
+	level float64
+	stage int
+	down  bool
+}
+
+// NewPitchEnvelope builds the pitch EG from the voice's rates and levels.
+func NewPitchEnvelope(rates [4]byte, levels [4]byte, sampleRate int) *PitchEnvelope {
+	e := &PitchEnvelope{down: true}
+
+	for i := 0; i < 4; i++ {
+		e.targets[i] = pitchSemitones(int(levels[i]))
+
+		// Semitones per sample, from minutes at rate 0 to a few milliseconds at 99
+		e.incs[i] = 0.15 * math.Exp2(float64(rates[i])/7.5) * 48 / 49 / float64(sampleRate)
+	}
+
+	e.level = e.targets[3]
+
+	return e
+}
+
+// Release moves the pitch EG into its release stage.
+func (e *PitchEnvelope) Release() {
+	e.down = false
+	e.stage = 3
+}
+
+// Next advances the pitch EG by one sample and returns the bend in semitones.
+func (e *PitchEnvelope) Next() float64 {
+	target := e.targets[e.stage]
+	inc := e.incs[e.stage]
+
+	switch {
+	case e.level < target:
+		e.level += inc
+		if e.level >= target {
+			e.level = target
+		}
+	case e.level > target:
+		e.level -= inc
+		if e.level <= target {
+			e.level = target
+		}
+	}
+
+	if e.level == target && e.down && e.stage < 2 {
+		e.stage++
+	}
+
+	return e.level
+}
+
+// pitchSemitones maps a pitch EG level 0 - 99 onto a bend, finer around the center.
+func pitchSemitones(level int) float64 {
+	switch {
+	case level < 50:
+		return -48 * math.Pow(float64(50-level)/50, 1.5)
+	case level > 50:
+		return 48 * math.Pow(float64(level-50)/49, 1.5)
+	}
+	return 0
+}
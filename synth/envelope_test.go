@@ -0,0 +1,113 @@
+package synth
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScaleLevel(t *testing.T) {
+	tests := map[int]int{-1: 0, 0: 0, 1: 5, 10: 31, 19: 46, 20: 48, 50: 78, 99: 127, 120: 127}
+
+	for level, expect := range tests {
+		if got := scaleLevel(level); got != expect {
+			t.Errorf("level %d: got %d, expected %d", level, got, expect)
+		}
+	}
+}
+
+// Targets and rates follow msfa's Env: an output level of 99 at full velocity puts EG
+// level 99 at 3840, where the operator peaks at 2.0.
+func TestEnvelopeLevels(t *testing.T) {
+	full := scaleLevel(99) << 5
+
+	tests := []struct {
+		level  byte
+		out    int
+		expect float64
+	}{
+		{99, full, 3840},
+		{50, full, 2304},
+		{0, full, 16},
+		{99, scaleLevel(50) << 5, 2272},
+		{99, 0, 16},
+	}
+
+	for _, test := range tests {
+		e := NewEnvelope([4]byte{99, 99, 99, 99}, [4]byte{test.level, test.level, test.level, test.level}, test.out, 0, 44100)
+		if e.targets[0] != test.expect {
+			t.Errorf("EG level %d at output %d: got %v, expected %v", test.level, test.out, e.targets[0], test.expect)
+		}
+	}
+
+	if got := gain(3840); got != 2 {
+		t.Errorf("gain at the top: got %v, expected 2", got)
+	}
+}
+
+// Decays are linear on the internal scale, so the time from level 99 down to 0 is
+// the distance over msfa's increment for the rate.
+func TestEnvelopeTimes(t *testing.T) {
+	tests := []struct {
+		rate        byte
+		rateScaling int
+		sampleRate  int
+		expect      int
+	}{
+		{99, 0, 44100, 274},    // qrate 63, 14 units a sample
+		{50, 0, 44100, 61184},  // qrate 32, 1/16 unit a sample, 1.39s
+		{25, 0, 44100, 978944}, // qrate 16, 1/256 unit a sample, 22.2s
+		{50, 4, 44100, 30592},  // rate scaling of 4 is one doubling faster
+		{50, 0, 22050, 30592},  // half the samples at half the rate
+		{99, 20, 44100, 274},   // rates stop at qrate 63
+	}
+
+	for _, test := range tests {
+		e := NewEnvelope([4]byte{99, test.rate, 99, 99}, [4]byte{99, 0, 0, 0}, scaleLevel(99)<<5, test.rateScaling, test.sampleRate)
+
+		// Attack to the top first
+		for i := 0; e.Next() < 3840; i++ {
+			if i > test.sampleRate {
+				t.Fatalf("rate %d: the attack never reached the top", test.rate)
+			}
+		}
+
+		samples := 0
+		for e.level > 16 {
+			e.Next()
+			samples++
+		}
+
+		if samples != test.expect {
+			t.Errorf("rate %d, rate scaling %d at %dHz: decayed in %d samples, expected %d", test.rate, test.rateScaling, test.sampleRate, samples, test.expect)
+		}
+	}
+}
+
+func TestEnvelopeRelease(t *testing.T) {
+	e := NewEnvelope([4]byte{99, 99, 99, 99}, [4]byte{99, 99, 99, 0}, scaleLevel(99)<<5, 0, 44100)
+
+	for i := 0; i < 1000; i++ {
+		e.Next()
+	}
+	if e.level != 3840 || e.Done() {
+		t.Fatalf("held at %v, expected 3840 and not done", e.level)
+	}
+
+	e.Release()
+	for i := 0; i < 1000 && !e.Done(); i++ {
+		e.Next()
+	}
+	if !e.Done() || e.level != 16 {
+		t.Errorf("released to %v, expected 16 and done", e.level)
+	}
+}
+
+func TestPitchEnvelope(t *testing.T) {
+	tests := map[int]float64{0: -48, 25: -48 * math.Pow(0.5, 1.5), 50: 0, 99: 48}
+
+	for level, expect := range tests {
+		if got := pitchSemitones(level); math.Abs(got-expect) > 1e-9 {
+			t.Errorf("pitch EG level %d: got %v semitones, expected %v", level, got, expect)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package synth
+
+import (
+	"time"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// graphRate is how often Graph samples the EGs, fine enough for the fastest attacks.
+const graphRate = 2000
+
+// maxGraphTime caps the held note and the release of a graph, EGs at rate 0 take minutes.
+const maxGraphTime = 10 * time.Second
+
+// EnvelopeGraph is every EG of a voice sampled over the same span of time.
+type EnvelopeGraph struct {
+	Operators [6][]float64 // OP1 - OP6, 0 silent to 1 at level 99
+	Pitch     []float64    // the bend in semitones
+	Step      time.Duration
+	Release   int // the point where the key is released
+}
+
+// Duration is the time the whole graph covers.
+func (g EnvelopeGraph) Duration() time.Duration {
+	return g.Step * time.Duration(len(g.Pitch))
+}
+
+// Graph follows the EGs of a voice through a note at middle C, held until the
+// slowest EG reaches its sustain level and then released until every EG is
+// done, in points samples. The operators play at full output level, so the
+// graph shows the shape of each EG rather than how loud the operator is.
+func Graph(voice parse.Voice, points int) EnvelopeGraph {
+	if points < 1 || len(voice.Operators) != 6 {
+		return EnvelopeGraph{}
+	}
+
+	// Time to sustain, then time to settle after the release
+	hold, release := 0, 0
+	ops, pitch := graphEnvelopes(voice)
+	for n := 0; n < graphSamples(maxGraphTime) && !graphSustained(ops, pitch); n++ {
+		graphNext(ops, pitch)
+		hold++
+	}
+	hold += hold/10 + graphSamples(100*time.Millisecond)
+
+	ops, pitch = graphEnvelopes(voice)
+	for n := 0; n < hold; n++ {
+		graphNext(ops, pitch)
+	}
+	graphRelease(ops, pitch)
+	for n := 0; n < graphSamples(maxGraphTime) && !graphDone(ops, pitch); n++ {
+		graphNext(ops, pitch)
+		release++
+	}
+	release += graphSamples(100 * time.Millisecond)
+
+	// Each point is the loudest sample of its stretch, so short peaks still show
+	total := hold + release
+	g := EnvelopeGraph{
+		Pitch:   make([]float64, points),
+		Step:    time.Duration(total) * time.Second / graphRate / time.Duration(points),
+		Release: hold * points / total,
+	}
+	for op := range g.Operators {
+		g.Operators[op] = make([]float64, points)
+	}
+
+	top := float64(graphTarget(99) - 16)
+	ops, pitch = graphEnvelopes(voice)
+	for n := 0; n < total; n++ {
+		if n == hold {
+			graphRelease(ops, pitch)
+		}
+		point := n * points / total
+		for op, e := range ops {
+			if level := (e.Next() - 16) / top; level > g.Operators[op][point] {
+				g.Operators[op][point] = level
+			}
+		}
+		g.Pitch[point] = pitch.Next()
+	}
+
+	return g
+}
+
+// graphTarget is the internal EG level for an EG level 0 - 99 at full output level.
+func graphTarget(level int) int {
+	return (scaleLevel(level)>>1)<<6 + scaleLevel(99)<<5 - 4256
+}
+
+func graphEnvelopes(voice parse.Voice) ([6]*Envelope, *PitchEnvelope) {
+	var ops [6]*Envelope
+	for op := 1; op <= 6; op++ {
+		o := voice.Operator(op)
+		ops[op-1] = NewEnvelope(
+			[4]byte{o.EGRate1, o.EGRate2, o.EGRate3, o.EGRate4},
+			[4]byte{o.EGLevel1, o.EGLevel2, o.EGLevel3, o.EGLevel4},
+			scaleLevel(99)<<5, rateScaling(60, int(o.RateScale)), graphRate)
+	}
+
+	pitch := NewPitchEnvelope(
+		[4]byte{voice.PitchEGRate1, voice.PitchEGRate2, voice.PitchEGRate3, voice.PitchEGRate4},
+		[4]byte{voice.PitchEGLevel1, voice.PitchEGLevel2, voice.PitchEGLevel3, voice.PitchEGLevel4},
+		graphRate)
+
+	return ops, pitch
+}
+
+func graphNext(ops [6]*Envelope, pitch *PitchEnvelope) {
+	for _, e := range ops {
+		e.Next()
+	}
+	pitch.Next()
+}
+
+func graphRelease(ops [6]*Envelope, pitch *PitchEnvelope) {
+	for _, e := range ops {
+		e.Release()
+	}
+	pitch.Release()
+}
+
+// graphSustained reports whether every EG has reached Level3.
+func graphSustained(ops [6]*Envelope, pitch *PitchEnvelope) bool {
+	for _, e := range ops {
+		if e.stage < 2 || e.level != e.targets[2] {
+			return false
+		}
+	}
+	return pitch.stage == 2 && pitch.level == pitch.targets[2]
+}
+
+// graphDone reports whether every EG has released and settled.
+func graphDone(ops [6]*Envelope, pitch *PitchEnvelope) bool {
+	for _, e := range ops {
+		if !e.Done() {
+			return false
+		}
+	}
+	return pitch.level == pitch.targets[3]
+}
+
+func graphSamples(d time.Duration) int {
+	return toSamples(d, graphRate)
+}
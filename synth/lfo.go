@@ -0,0 +1,97 @@
+package synth
+
+import "math"
+
+// LFO waves, the same numbers as Voice.LfoWave.
+const (
+	Triangle = iota
+	SawDown
+	SawUp
+	Square
+	Sine
+	SampleHold
+)
+
+// LFO is the voice's low frequency oscillator, shared by all operators.
+type LFO struct {
+	wave  int
+	inc   float64
+	phase float64
+
+	delay   int
+	fade    int
+	elapsed int
+
+	held float64
+	seed uint32
+}
+
+// NewLFO builds the LFO from speed, delay and wave 0 - 99, 0 - 99 and 0 - 5.
+func NewLFO(speed byte, delay byte, wave byte, sampleRate int) *LFO {
+	l := &LFO{wave: int(wave), seed: 0x2545F491}
+
+	// About 0.06Hz at speed 0 up to 50Hz at 99
+	hz := 0.062 * math.Exp(math.Log(800)*float64(speed)/99)
+	l.inc = hz / float64(sampleRate)
+
+	// The delay holds the LFO back, then fades it in over half as long again
+	if delay > 0 {
+		seconds := 0.005 * math.Exp2(float64(delay)/10)
+		l.delay = int(seconds * float64(sampleRate))
+		l.fade = l.delay/2 + 1
+	}
+
+	l.held = l.random()
+
+	return l
+}
+
+// Next advances the LFO by one sample and returns its output, -1 to 1, scaled by the delay fade in.
+func (l *LFO) Next() float64 {
+	var value float64
+
+	switch l.wave {
+	case SawDown:
+		value = 1 - 2*l.phase
+	case SawUp:
+		value = 2*l.phase - 1
+	case Square:
+		value = 1
+		if l.phase >= 0.5 {
+			value = -1
+		}
+	case Sine:
+		value = math.Sin(2 * math.Pi * l.phase)
+	case SampleHold:
+		value = l.held
+	default:
+		value = 4*l.phase - 1
+		if l.phase >= 0.5 {
+			value = 3 - 4*l.phase
+		}
+	}
+
+	l.phase += l.inc
+	if l.phase >= 1 {
+		l.phase -= 1
+		l.held = l.random()
+	}
+
+	l.elapsed++
+	if l.elapsed <= l.delay {
+		return 0
+	}
+	if l.elapsed < l.delay+l.fade {
+		return value * float64(l.elapsed-l.delay) / float64(l.fade)
+	}
+
+	return value
+}
+
+// random is a small xorshift generator so sample and hold renders the same every time.
+func (l *LFO) random() float64 {
+	l.seed ^= l.seed << 13
+	l.seed ^= l.seed >> 17
+	l.seed ^= l.seed << 5
+	return float64(l.seed)/float64(math.MaxUint32)*2 - 1
+}
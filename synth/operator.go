@@ -0,0 +1,98 @@
+package synth
+
+import (
+	"math"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// expScaling is the shape of the exponential keyboard level scaling curves.
+var expScaling = [33]int{
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 11, 14, 16, 19, 23, 27, 33,
+	39, 47, 56, 66, 80, 94, 110, 126, 142, 158, 174, 190, 206, 222, 238, 250,
+}
+
+// velocityTable maps every other velocity onto the internal scale.
+var velocityTable = [64]int{
+	0, 70, 86, 97, 106, 114, 121, 126, 132, 138, 142, 148, 152, 156, 160, 163,
+	166, 170, 173, 174, 178, 181, 184, 186, 189, 190, 194, 196, 198, 200, 202, 205,
+	206, 209, 211, 214, 216, 218, 220, 222, 224, 225, 227, 229, 230, 232, 233, 235,
+	237, 238, 240, 241, 242, 243, 244, 246, 246, 248, 249, 250, 251, 252, 253, 254,
+}
+
+// ampModSensitivity is the share of the LFO AM depth an operator gets for AMS 0 - 3.
+var ampModSensitivity = [4]float64{0, 0.259, 0.427, 1}
+
+// pitchModSensitivity is the LFO pitch swing in semitones for PMS 0 - 7 at full depth.
+var pitchModSensitivity = [8]float64{0, 0.25, 0.5, 0.8, 1.4, 2.4, 4.1, 7}
+
+// Frequency returns the operator's frequency in Hz for a MIDI key, before
+// the pitch EG and LFO. Detune follows msfa as Dexed ships it.
+func Frequency(o parse.Operator, key int) float64 {
+	detune := float64(int(o.Detune) - 7)
+
+	if o.OscillatorMode == 1 {
+		// Fixed frequencies are only ever detuned upwards
+		if detune > 0 {
+			return o.FixedFrequency() * math.Exp2(13457*detune/(1<<24))
+		}
+		return o.FixedFrequency()
+	}
+
+	// Detune 7 is centered, and each step counts for less the higher the key
+	octaves := math.Log2(440) + float64(key-69)/12
+	octaves += 0.0209 * math.Exp(-0.396*octaves) / 7 * octaves * detune
+
+	return math.Exp2(octaves) * o.Ratio()
+}
+
+// levelScaling returns the change in output level on the internal scale from
+// the operator's keyboard level scaling, breakpoint 0 is A-1.
+func levelScaling(key int, o parse.Operator) int {
+	offset := key - int(o.LevelScalingBreakPoint) - 17
+	if offset >= 0 {
+		return scalingCurve((offset+1)/3, int(o.ScaleRightDepth), int(o.ScaleRightCurve))
+	}
+	return scalingCurve(-(offset-1)/3, int(o.ScaleLeftDepth), int(o.ScaleLeftCurve))
+}
+
+// scalingCurve applies curve 0 - 3 (-LIN, -EXP, +EXP, +LIN) to a distance in groups of three keys.
+func scalingCurve(group int, depth int, curve int) int {
+	var scale int
+	if curve == 0 || curve == 3 {
+		scale = (group * depth * 329) >> 12
+	} else {
+		if group > len(expScaling)-1 {
+			group = len(expScaling) - 1
+		}
+		scale = (expScaling[group] * depth * 329) >> 15
+	}
+	if curve < 2 {
+		scale = -scale
+	}
+	return scale
+}
+
+// velocityScaling returns the change in output level for a velocity at sensitivity 0 - 7.
+func velocityScaling(velocity int, sensitivity int) int {
+	if velocity < 0 {
+		velocity = 0
+	}
+	if velocity > 127 {
+		velocity = 127
+	}
+	value := velocityTable[velocity>>1] - 239
+	return ((sensitivity*value + 7) >> 3) << 4
+}
+
+// rateScaling returns how much faster the EG runs for a key at rate scale 0 - 7.
+func rateScaling(key int, sensitivity int) int {
+	x := key/3 - 7
+	if x < 0 {
+		x = 0
+	}
+	if x > 31 {
+		x = 31
+	}
+	return (sensitivity * x) >> 3
+}
@@ -0,0 +1,89 @@
+package synth
+
+import (
+	"math"
+	"testing"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// Expected frequencies are msfa's osc_freq, as Dexed ships it, turned back into Hz.
+func TestFrequency(t *testing.T) {
+	tests := []struct {
+		name   string
+		op     parse.Operator
+		key    int
+		expect float64
+	}{
+		{"A4 centered", parse.Operator{FrequencyCoarse: 1, Detune: 7}, 69, 440.0000},
+		{"A4 detune 14", parse.Operator{FrequencyCoarse: 1, Detune: 14}, 69, 441.7323},
+		{"A4 detune 0", parse.Operator{FrequencyCoarse: 1, Detune: 0}, 69, 438.2745},
+		{"C2 detune 0", parse.Operator{FrequencyCoarse: 1, Detune: 0}, 36, 64.8840},
+		{"C7 detune 14", parse.Operator{FrequencyCoarse: 1, Detune: 14}, 96, 2097.2471},
+		{"C4 centered", parse.Operator{FrequencyCoarse: 1, Detune: 7}, 60, 261.6256},
+		{"C4 ratio 2 detune 14", parse.Operator{FrequencyCoarse: 2, Detune: 14}, 60, 525.7879},
+		{"C4 ratio 2 detune 0", parse.Operator{FrequencyCoarse: 2, Detune: 0}, 60, 520.7266},
+		{"ratio 0.50", parse.Operator{FrequencyCoarse: 0, Detune: 7}, 69, 220.0000},
+		{"ratio 4.50", parse.Operator{FrequencyCoarse: 3, FrequencyFine: 50, Detune: 7}, 69, 1980.0000},
+		{"fixed 1Hz", parse.Operator{OscillatorMode: 1, FrequencyCoarse: 0, Detune: 7}, 69, 1.0000},
+		{"fixed 100Hz", parse.Operator{OscillatorMode: 1, FrequencyCoarse: 2, Detune: 7}, 20, 100.0000},
+		{"fixed 100Hz detune 14", parse.Operator{OscillatorMode: 1, FrequencyCoarse: 2, Detune: 14}, 69, 100.3899},
+		{"fixed 100Hz detune 0", parse.Operator{OscillatorMode: 1, FrequencyCoarse: 2, Detune: 0}, 69, 100.0000},
+		{"fixed 31.62Hz", parse.Operator{OscillatorMode: 1, FrequencyCoarse: 1, FrequencyFine: 50, Detune: 7}, 69, 31.6228},
+		{"fixed 9772Hz", parse.Operator{OscillatorMode: 1, FrequencyCoarse: 3, FrequencyFine: 99, Detune: 7}, 69, 9772.3639},
+	}
+
+	for _, test := range tests {
+		got := Frequency(test.op, test.key)
+		if math.Abs(got-test.expect) > test.expect*1e-5 {
+			t.Errorf("%s: got %.4f Hz, expected %.4f Hz", test.name, got, test.expect)
+		}
+	}
+}
+
+func TestLevelScaling(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    int
+		op     parse.Operator
+		expect int
+	}{
+		{"at the breakpoint", 56, parse.Operator{LevelScalingBreakPoint: 39, ScaleRightDepth: 99, ScaleRightCurve: 3}, 0},
+		{"right +LIN", 96, parse.Operator{LevelScalingBreakPoint: 39, ScaleRightDepth: 99, ScaleRightCurve: 3}, 103},
+		{"right -LIN", 96, parse.Operator{LevelScalingBreakPoint: 39, ScaleRightDepth: 99, ScaleRightCurve: 0}, -103},
+		{"left -EXP", 24, parse.Operator{LevelScalingBreakPoint: 39, ScaleLeftDepth: 50, ScaleLeftCurve: 1}, -7},
+		{"left +EXP", 24, parse.Operator{LevelScalingBreakPoint: 39, ScaleLeftDepth: 50, ScaleLeftCurve: 2}, 7},
+		{"left +LIN", 24, parse.Operator{LevelScalingBreakPoint: 39, ScaleLeftDepth: 50, ScaleLeftCurve: 3}, 44},
+		{"right depth 0", 96, parse.Operator{LevelScalingBreakPoint: 39, ScaleRightDepth: 0, ScaleRightCurve: 3}, 0},
+		{"EXP past the table", 127, parse.Operator{LevelScalingBreakPoint: 0, ScaleRightDepth: 99, ScaleRightCurve: 2}, 248},
+	}
+
+	for _, test := range tests {
+		if got := levelScaling(test.key, test.op); got != test.expect {
+			t.Errorf("%s: got %d, expected %d", test.name, got, test.expect)
+		}
+	}
+}
+
+func TestVelocityScaling(t *testing.T) {
+	tests := []struct {
+		velocity    int
+		sensitivity int
+		expect      int
+	}{
+		{127, 7, 224},
+		{0, 7, -3344},
+		{100, 3, 16},
+		{64, 7, -448},
+		{127, 0, 0},
+		{0, 0, 0},
+		{200, 7, 224},
+		{-5, 7, -3344},
+	}
+
+	for _, test := range tests {
+		if got := velocityScaling(test.velocity, test.sensitivity); got != test.expect {
+			t.Errorf("velocity %d at sensitivity %d: got %d, expected %d", test.velocity, test.sensitivity, got, test.expect)
+		}
+	}
+}
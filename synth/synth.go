@@ -0,0 +1,226 @@
+// Package synth renders DX7 voices to PCM without the hardware.
+//
+// The engine follows the DX7's own math where it is known: the log domain
+// operator EGs with their rate and level tables, keyboard rate and level
+// scaling, velocity sensitivity, detune, the feedback paths and all 32 algorithms.
+// The pitch EG and LFO are close approximations. Rendering is
+// fully deterministic, the same voice and notes always give the same samples.
+package synth
+
+import (
+	"math"
+	"time"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// DefaultSampleRate is used when Options.SampleRate is zero.
+const DefaultSampleRate = 44100
+
+// Options control how notes are rendered.
+type Options struct {
+	SampleRate int
+	// Release is rendered after the last key is released, for the EGs to ring out.
+	Release time.Duration
+}
+
+// DefaultOptions render at 44.1kHz with a one second release tail.
+var DefaultOptions = Options{SampleRate: DefaultSampleRate, Release: time.Second}
+
+// Note is a key held down from Start for Length.
+type Note struct {
+	Key      int
+	Velocity int
+	Start    time.Duration
+	Length   time.Duration
+}
+
+// Render plays a single note and returns mono samples between -1 and 1.
+func Render(voice parse.Voice, key int, velocity int, length time.Duration, opts Options) []float64 {
+	return RenderNotes(voice, []Note{{Key: key, Velocity: velocity, Length: length}}, opts)
+}
+
+// Chord holds the keys down together for length.
+func Chord(keys []int, velocity int, length time.Duration) []Note {
+	notes := make([]Note, len(keys))
+	for i, key := range keys {
+		notes[i] = Note{Key: key, Velocity: velocity, Length: length}
+	}
+	return notes
+}
+
+// RenderNotes plays any number of notes, one DX7 voice each, and returns mono
+// samples between -1 and 1. Chords that would clip are scaled down as a whole.
+func RenderNotes(voice parse.Voice, notes []Note, opts Options) []float64 {
+	sampleRate := opts.SampleRate
+	if sampleRate <= 0 {
+		sampleRate = DefaultSampleRate
+	}
+
+	end := time.Duration(0)
+	for _, note := range notes {
+		if note.Start+note.Length > end {
+			end = note.Start + note.Length
+		}
+	}
+
+	samples := make([]float64, toSamples(end+opts.Release, sampleRate))
+
+	for _, note := range notes {
+		start := toSamples(note.Start, sampleRate)
+		if start >= len(samples) {
+			continue
+		}
+		v := newVoice(voice, note.Key, note.Velocity, sampleRate)
+		v.render(samples[start:], toSamples(note.Length, sampleRate))
+	}
+
+	peak := 0.0
+	for _, sample := range samples {
+		peak = math.Max(peak, math.Abs(sample))
+	}
+	if peak > 1 {
+		for i := range samples {
+			samples[i] /= peak
+		}
+	}
+
+	return samples
+}
+
+// PCM16 converts samples between -1 and 1 into 16 bit integers.
+func PCM16(samples []float64) []int16 {
+	pcm := make([]int16, len(samples))
+	for i, sample := range samples {
+		sample = math.Max(-1, math.Min(1, sample))
+		pcm[i] = int16(math.Round(sample * 32767))
+	}
+	return pcm
+}
+
+func toSamples(d time.Duration, sampleRate int) int {
+	return int(d.Seconds() * float64(sampleRate))
+}
+
+// operator holds the playing state of one operator.
+type operator struct {
+	env   *Envelope
+	phase float64
+	inc   float64
+	fixed bool
+	ams   float64
+	out   float64
+}
+
+// voice holds the playing state of one note.
+type voice struct {
+	algorithm parse.Algorithm
+	ops       [6]operator // OP1 - OP6
+
+	pitch    *PitchEnvelope
+	lfo      *LFO
+	pmDepth  float64 // semitones at full LFO swing
+	amDepth  float64 // internal level units at full LFO swing
+	feedback float64 // cycles of phase per unit of output
+	history  [2]float64
+	carriers float64
+}
+
+func newVoice(v parse.Voice, key int, velocity int, sampleRate int) *voice {
+	n := &voice{algorithm: v.Topology(), carriers: float64(len(v.Topology().Carriers))}
+
+	// Transpose 24 is C3, no change
+	key += int(v.Transpose) - 24
+
+	for op := 1; op <= 6; op++ {
+		o := v.Operator(op)
+
+		outLevel := scaleLevel(int(o.OutputLevel)) + levelScaling(key, o)
+		if outLevel > 127 {
+			outLevel = 127
+		}
+		outLevel = outLevel<<5 + velocityScaling(velocity, int(o.KeyVelocitySensitivity))
+		if outLevel < 0 {
+			outLevel = 0
+		}
+
+		n.ops[op-1] = operator{
+			env: NewEnvelope(
+				[4]byte{o.EGRate1, o.EGRate2, o.EGRate3, o.EGRate4},
+				[4]byte{o.EGLevel1, o.EGLevel2, o.EGLevel3, o.EGLevel4},
+				outLevel, rateScaling(key, int(o.RateScale)), sampleRate),
+			inc:   Frequency(o, key) / float64(sampleRate),
+			fixed: o.OscillatorMode == 1,
+			ams:   ampModSensitivity[o.AmplitudeModulationSensitivity&3],
+		}
+	}
+
+	n.pitch = NewPitchEnvelope(
+		[4]byte{v.PitchEGRate1, v.PitchEGRate2, v.PitchEGRate3, v.PitchEGRate4},
+		[4]byte{v.PitchEGLevel1, v.PitchEGLevel2, v.PitchEGLevel3, v.PitchEGLevel4},
+		sampleRate)
+
+	n.lfo = NewLFO(v.LfoSpeed, v.LfoDelay, v.LfoWave, sampleRate)
+	n.pmDepth = float64(v.LfoPitchModDepth) / 99 * pitchModSensitivity[v.LfoPitchModSensitivity&7]
+	n.amDepth = float64(v.LfoAMDepth) / 99 * 8 * 256
+
+	if v.Feedback > 0 {
+		n.feedback = math.Exp2(float64(v.Feedback) - 8)
+	}
+
+	return n
+}
+
+// render adds the note to out, releasing the key after held samples.
+func (n *voice) render(out []float64, held int) {
+	for i := range out {
+		if i == held {
+			n.pitch.Release()
+			for op := range n.ops {
+				n.ops[op].env.Release()
+			}
+		}
+
+		lfo := n.lfo.Next()
+		bend := math.Exp2((n.pitch.Next() + lfo*n.pmDepth) / 12)
+
+		// AM only ever attenuates
+		am := (1 - lfo) / 2 * n.amDepth
+
+		// Modulators always have higher numbers, so work down from OP6
+		sample := 0.0
+		for op := 6; op >= 1; op-- {
+			o := &n.ops[op-1]
+
+			modulation := 0.0
+			for _, m := range n.algorithm.Modulators[op-1] {
+				modulation += n.ops[m-1].out
+			}
+			if op == n.algorithm.FeedbackTo && n.feedback > 0 {
+				modulation += (n.history[0] + n.history[1]) / 2 * n.feedback
+			}
+
+			level := o.env.Next() - am*o.ams
+			o.out = gain(level) * math.Sin(2*math.Pi*(o.phase+modulation))
+
+			if o.fixed {
+				o.phase += o.inc
+			} else {
+				o.phase += o.inc * bend
+			}
+			o.phase -= math.Floor(o.phase)
+
+			if op == n.algorithm.Feedback {
+				n.history[1] = n.history[0]
+				n.history[0] = o.out
+			}
+
+			if n.algorithm.IsCarrier(op) {
+				sample += o.out
+			}
+		}
+
+		// Operators peak at 2.0, split the headroom between the carriers
+		out[i] += sample / (2 * n.carriers)
+	}
+}
@@ -0,0 +1,67 @@
+package synth
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// goldenVoice is the INIT VOICE with OP2 modulating OP1 at twice its pitch, a slower
+// OP2 decay and feedback, so the EGs, the algorithm and feedback all show in the samples.
+func goldenVoice() parse.Voice {
+	voice := parse.InitVoice()
+	voice.Feedback = 6
+
+	op2 := &voice.Operators[4] // the voice data runs OP6 - OP1
+	op2.OutputLevel = 80
+	op2.FrequencyCoarse = 2
+	op2.EGRate2 = 40
+	op2.EGLevel2 = 60
+	op2.EGLevel3 = 60
+
+	return voice
+}
+
+func TestRenderGolden(t *testing.T) {
+	opts := Options{SampleRate: 22050, Release: 50 * time.Millisecond}
+
+	samples := Render(goldenVoice(), 60, 100, 100*time.Millisecond, opts)
+	if len(samples) != 3307 {
+		t.Fatalf("rendered %d samples, expected 3307", len(samples))
+	}
+
+	golden := map[int]float64{
+		1:    0.000668830643175416,
+		10:   -0.00369198647782295,
+		100:  0.124865635238133,
+		1000: -0.0646568015106075,
+		2000: -0.468203173621033,
+		3000: -1.79669413326759e-05,
+	}
+	for i, expect := range golden {
+		if math.Abs(samples[i]-expect) > 1e-9 {
+			t.Errorf("sample %d: got %.15g, expected %.15g", i, samples[i], expect)
+		}
+	}
+
+	again := Render(goldenVoice(), 60, 100, 100*time.Millisecond, opts)
+	for i := range samples {
+		if samples[i] != again[i] {
+			t.Fatalf("second render differs at sample %d: %v != %v", i, again[i], samples[i])
+		}
+	}
+}
+
+func TestRenderNotesNormalizes(t *testing.T) {
+	samples := RenderNotes(goldenVoice(), Chord([]int{48, 52, 55, 60, 64, 67}, 127, 200*time.Millisecond), Options{SampleRate: 22050})
+
+	peak := 0.0
+	for _, sample := range samples {
+		peak = math.Max(peak, math.Abs(sample))
+	}
+	if peak > 1 {
+		t.Errorf("chord peaks at %v, expected at most 1", peak)
+	}
+}
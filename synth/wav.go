@@ -0,0 +1,60 @@
+package synth
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// WriteWAV writes samples between -1 and 1 as a 16 bit mono WAV file.
+func WriteWAV(w io.Writer, samples []float64, sampleRate int) error {
+	if sampleRate <= 0 {
+		sampleRate = DefaultSampleRate
+	}
+
+	pcm := PCM16(samples)
+	dataSize := uint32(len(pcm) * 2)
+
+	header := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'},
+		36 + dataSize,
+		[4]byte{'W', 'A', 'V', 'E'},
+
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16),             // fmt chunk size
+		uint16(1),              // PCM
+		uint16(1),              // mono
+		uint32(sampleRate),     // sample rate
+		uint32(sampleRate * 2), // byte rate
+		uint16(2),              // block align
+		uint16(16),             // bits per sample
+
+		[4]byte{'d', 'a', 't', 'a'},
+		dataSize,
+	}
+
+	for _, field := range header {
+		if err := binary.Write(w, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+
+	return binary.Write(w, binary.LittleEndian, pcm)
+}
+
+// SaveWAV writes samples to a WAV file.
+func SaveWAV(fileName string, samples []float64, sampleRate int) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if err := WriteWAV(w, samples, sampleRate); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
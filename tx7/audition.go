@@ -0,0 +1,267 @@
+package tx7
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Audition modes, what TestNotes plays after an upload.
+const (
+	AuditionChord    = "chord"    // the notes held together
+	AuditionArpeggio = "arpeggio" // the notes one after another
+	AuditionMIDI     = "midi"     // the start of a standard MIDI file
+	AuditionRange    = "range"    // the first note in every octave of the keyboard, for keyboard scaling
+	AuditionVelocity = "velocity" // the chord at rising velocities, for velocity sensitivity
+	AuditionOff      = "off"
+)
+
+// AuditionModes lists the modes in the order they are offered.
+var AuditionModes = []string{AuditionChord, AuditionArpeggio, AuditionMIDI, AuditionRange, AuditionVelocity, AuditionOff}
+
+// MaxAuditionLength cuts a MIDI file short, an audition is not a playback.
+const MaxAuditionLength = 10 * time.Second
+
+// Audition describes the test phrase played after an upload.
+type Audition struct {
+	Mode     string
+	Notes    []int64
+	Velocity int64
+	Length   time.Duration // of each note, or each step of a sweep
+	File     string        // standard MIDI file played in AuditionMIDI mode
+	Banks    bool          // also audition after a bank upload
+}
+
+// DefaultAudition plays a C major chord for a quarter second.
+var DefaultAudition = Audition{Mode: AuditionChord, Notes: []int64{60, 64, 67}, Velocity: 100, Length: time.Second / 4, Banks: true}
+
+// noteEvent is a note on or off at a time from the start of the audition.
+type noteEvent struct {
+	At       time.Duration
+	On       bool
+	Note     int64
+	Velocity int64
+}
+
+// events lays out the audition as note on and off events, sorted by time.
+func (a Audition) events() ([]noteEvent, error) {
+	var events []noteEvent
+
+	play := func(at time.Duration, note int64, velocity int64) {
+		events = append(events, noteEvent{At: at, On: true, Note: note, Velocity: velocity}, noteEvent{At: at + a.Length, Note: note})
+	}
+
+	switch a.Mode {
+	case AuditionChord, "":
+		for _, note := range a.Notes {
+			play(0, note, a.Velocity)
+		}
+
+	case AuditionArpeggio:
+		for i, note := range a.Notes {
+			play(time.Duration(i)*a.Length, note, a.Velocity)
+		}
+
+	case AuditionRange:
+		root := int64(60)
+		if len(a.Notes) > 0 {
+			root = a.Notes[0]
+		}
+		// The DX7 keyboard runs from C1 (36) to C6 (96)
+		step := 0
+		for note := 36 + root%12; note <= 96; note += 12 {
+			play(time.Duration(step)*a.Length, note, a.Velocity)
+			step++
+		}
+
+	case AuditionVelocity:
+		for step, velocity := range []int64{16, 40, 64, 88, 112, 127} {
+			for _, note := range a.Notes {
+				play(time.Duration(step)*a.Length, note, velocity)
+			}
+		}
+
+	case AuditionMIDI:
+		data, err := os.ReadFile(a.File)
+		if err != nil {
+			return nil, err
+		}
+		events, err = readMIDIFile(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", a.File, err)
+		}
+
+	case AuditionOff:
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("unknown audition mode [%s]", a.Mode)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At < events[j].At })
+
+	return events, nil
+}
+
+// readMIDIFile reads the notes of a format 0 or 1 standard MIDI file, merging all
+// tracks and channels and stopping at MaxAuditionLength.
+func readMIDIFile(data []byte) ([]noteEvent, error) {
+	if len(data) < 14 || string(data[:4]) != "MThd" {
+		return nil, errors.New("not a standard MIDI file")
+	}
+
+	division := binary.BigEndian.Uint16(data[12:14])
+	if division&0x8000 != 0 || division == 0 {
+		return nil, errors.New("SMPTE timed MIDI files are not supported")
+	}
+
+	type timed struct {
+		tick  uint64
+		tempo uint32 // set for tempo changes
+		event noteEvent
+	}
+	var all []timed
+
+	// Lengths come from the file, never trust them past the data that is there
+	headerLength := binary.BigEndian.Uint32(data[4:8])
+	if uint64(headerLength) > uint64(len(data)-8) {
+		return nil, errors.New("truncated header")
+	}
+
+	r := bytes.NewReader(data[8+headerLength:])
+	for r.Len() >= 8 {
+		chunk := make([]byte, 8)
+		r.Read(chunk)
+		length := binary.BigEndian.Uint32(chunk[4:8])
+		if uint64(length) > uint64(r.Len()) {
+			return nil, errors.New("truncated track")
+		}
+		track := make([]byte, length)
+		r.Read(track)
+		if string(chunk[:4]) != "MTrk" {
+			continue
+		}
+
+		t := bytes.NewReader(track)
+		tick := uint64(0)
+		status := byte(0)
+		for t.Len() > 0 {
+			delta, err := readVarLen(t)
+			if err != nil {
+				return nil, err
+			}
+			tick += uint64(delta)
+
+			b, _ := t.ReadByte()
+			if b < 0x80 {
+				// Running status
+				t.UnreadByte()
+				b = status
+			}
+
+			switch {
+			case b == 0xFF:
+				kind, _ := t.ReadByte()
+				length, err := readVarLen(t)
+				if err != nil {
+					return nil, err
+				}
+				if int64(length) > int64(t.Len()) {
+					return nil, errors.New("meta event runs past the end of its track")
+				}
+				meta := make([]byte, length)
+				t.Read(meta)
+				if kind == 0x51 && length == 3 {
+					all = append(all, timed{tick: tick, tempo: uint32(meta[0])<<16 | uint32(meta[1])<<8 | uint32(meta[2])})
+				}
+				if kind == 0x2F {
+					t.Seek(0, 2)
+				}
+
+			case b == 0xF0 || b == 0xF7:
+				length, err := readVarLen(t)
+				if err != nil {
+					return nil, err
+				}
+				if int64(length) > int64(t.Len()) {
+					return nil, errors.New("sysex event runs past the end of its track")
+				}
+				t.Seek(int64(length), 1)
+
+			case b >= 0x80:
+				status = b
+				data1, _ := t.ReadByte()
+				data2 := byte(0)
+				if b&0xE0 != 0xC0 {
+					// Everything but program change and channel pressure has two data bytes
+					data2, _ = t.ReadByte()
+				}
+
+				switch b & 0xF0 {
+				case 0x90:
+					all = append(all, timed{tick: tick, event: noteEvent{On: data2 > 0, Note: int64(data1), Velocity: int64(data2)}})
+				case 0x80:
+					all = append(all, timed{tick: tick, event: noteEvent{Note: int64(data1)}})
+				}
+
+			default:
+				return nil, fmt.Errorf("bad status byte %#x", b)
+			}
+		}
+	}
+
+	sort.SliceStable(all, func(i, j int) bool { return all[i].tick < all[j].tick })
+
+	var events []noteEvent
+	held := make(map[int64]bool)
+	tempo := uint32(500000) // microseconds per quarter note, 120 bpm
+	at, last := time.Duration(0), uint64(0)
+	for _, e := range all {
+		// In float64, a long gap at a slow tempo overflows a Duration
+		elapsed := float64(e.tick-last) * float64(tempo) / float64(division) * float64(time.Microsecond)
+		last = e.tick
+		if elapsed > float64(MaxAuditionLength-at) {
+			at = MaxAuditionLength
+			break
+		}
+		at += time.Duration(elapsed)
+
+		if e.tempo > 0 {
+			tempo = e.tempo
+			continue
+		}
+
+		e.event.At = at
+		events = append(events, e.event)
+		held[e.event.Note] = e.event.On
+	}
+
+	// Release anything still held when the file was cut short
+	for note, on := range held {
+		if on {
+			events = append(events, noteEvent{At: at, Note: note})
+		}
+	}
+
+	return events, nil
+}
+
+// readVarLen reads a MIDI variable length quantity.
+func readVarLen(r *bytes.Reader) (uint32, error) {
+	value := uint32(0)
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, errors.New("truncated MIDI event")
+		}
+		value = value<<7 | uint32(b&0x7F)
+		if b&0x80 == 0 {
+			return value, nil
+		}
+	}
+	return 0, errors.New("bad variable length value")
+}
@@ -0,0 +1,171 @@
+package tx7
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// smf builds a format 1 standard MIDI file from track event data.
+func smf(division uint16, tracks ...[]byte) []byte {
+	data := []byte("MThd")
+	data = binary.BigEndian.AppendUint32(data, 6)
+	data = binary.BigEndian.AppendUint16(data, 1)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(tracks)))
+	data = binary.BigEndian.AppendUint16(data, division)
+
+	for _, track := range tracks {
+		data = append(data, "MTrk"...)
+		data = binary.BigEndian.AppendUint32(data, uint32(len(track)))
+		data = append(data, track...)
+	}
+
+	return data
+}
+
+// varLen writes a MIDI variable length quantity.
+func varLen(value uint32) []byte {
+	out := []byte{byte(value & 0x7F)}
+	for value >>= 7; value > 0; value >>= 7 {
+		out = append([]byte{byte(value&0x7F) | 0x80}, out...)
+	}
+	return out
+}
+
+// event is a delta time followed by the event bytes.
+func event(delta uint32, data ...byte) []byte {
+	return append(varLen(delta), data...)
+}
+
+func track(events ...[]byte) []byte {
+	var out []byte
+	for _, e := range events {
+		out = append(out, e...)
+	}
+	return out
+}
+
+func TestReadMIDIFile(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []noteEvent
+	}{
+		{
+			"running status",
+			smf(96, track(
+				event(0, 0x90, 60, 100),
+				event(0, 64, 90),
+				event(96, 60, 0),
+				event(0, 64, 0),
+			)),
+			[]noteEvent{
+				{At: 0, On: true, Note: 60, Velocity: 100},
+				{At: 0, On: true, Note: 64, Velocity: 90},
+				{At: time.Second / 2, Note: 60},
+				{At: time.Second / 2, Note: 64},
+			},
+		},
+		{
+			"running status kept over meta and sysex events",
+			smf(96, track(
+				event(0, 0x90, 60, 100),
+				event(0, 0xFF, 0x01, 2, 'h', 'i'),
+				event(0, 0xF0, 2, 0x7E, 0xF7),
+				event(96, 60, 0),
+			)),
+			[]noteEvent{
+				{At: 0, On: true, Note: 60, Velocity: 100},
+				{At: time.Second / 2, Note: 60},
+			},
+		},
+		{
+			"tempo change",
+			smf(96, track(
+				event(0, 0xFF, 0x51, 3, 0x0F, 0x42, 0x40), // 60 bpm
+				event(0, 0x90, 60, 100),
+				event(96, 0x80, 60, 0),
+				event(0, 0xFF, 0x51, 3, 0x07, 0xA1, 0x20), // 120 bpm
+				event(0, 0x90, 62, 100),
+				event(96, 0x80, 62, 0),
+			)),
+			[]noteEvent{
+				{At: 0, On: true, Note: 60, Velocity: 100},
+				{At: time.Second, Note: 60},
+				{At: time.Second, On: true, Note: 62, Velocity: 100},
+				{At: time.Second * 3 / 2, Note: 62},
+			},
+		},
+		{
+			"tempo track merged with a note track",
+			smf(96,
+				track(
+					event(0, 0xFF, 0x51, 3, 0x07, 0xA1, 0x20),
+					event(192, 0xFF, 0x51, 3, 0x0F, 0x42, 0x40),
+				),
+				track(
+					event(0, 0x90, 60, 100),
+					event(288, 0x80, 60, 0),
+				),
+			),
+			[]noteEvent{
+				{At: 0, On: true, Note: 60, Velocity: 100},
+				{At: 2 * time.Second, Note: 60},
+			},
+		},
+		{
+			"long gap at the slowest tempo is cut off",
+			smf(1, track(
+				event(0, 0xFF, 0x51, 3, 0xFF, 0xFF, 0xFF),
+				event(0, 0x90, 60, 100),
+				event(0x0FFFFFFF, 0x80, 60, 0),
+			)),
+			[]noteEvent{
+				{At: 0, On: true, Note: 60, Velocity: 100},
+				{At: MaxAuditionLength, Note: 60},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := readMIDIFile(test.data)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestReadMIDIFileErrors(t *testing.T) {
+	truncatedHeader := smf(96, track(event(0, 0x90, 60, 100)))
+	binary.BigEndian.PutUint32(truncatedHeader[4:8], 0xFFFFFFF0)
+
+	truncatedTrack := smf(96, track(event(0, 0x90, 60, 100)))
+	binary.BigEndian.PutUint32(truncatedTrack[18:22], 100)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"not midi", []byte("RIFF0000WAVEfmt "), "not a standard MIDI file"},
+		{"smpte", smf(0xE728, track()), "SMPTE timed MIDI files are not supported"},
+		{"header length", truncatedHeader, "truncated header"},
+		{"track length", truncatedTrack, "truncated track"},
+		{"meta length", smf(96, track(event(0, 0xFF, 0x01, 0x7F, 'h', 'i'))), "meta event runs past the end of its track"},
+		{"sysex length", smf(96, track(event(0, 0xF0, 0x81, 0x00, 0x43))), "sysex event runs past the end of its track"},
+		{"delta", smf(96, track([]byte{0x81})), "truncated MIDI event"},
+		{"running status with no status", smf(96, track(event(0, 60, 100))), "bad status byte 0x0"},
+	}
+
+	for _, test := range tests {
+		_, err := readMIDIFile(test.data)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
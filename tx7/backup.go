@@ -0,0 +1,88 @@
+package tx7
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// Backup downloads the 32 internal voices and saves them in BackupDir, returning the file name.
+func (t *TX7) Backup(ctx context.Context) (string, error) {
+	var original parse.Bank
+
+	err := t.DownloadBankContext(ctx, func(bank parse.Bank) {
+		original = bank
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return t.saveBackup(original)
+}
+
+// saveBackup writes a downloaded bank into BackupDir under a timestamped name. A backup
+// made in the same second gets a counter after the time instead of replacing the first.
+func (t *TX7) saveBackup(bank parse.Bank) (string, error) {
+	if err := os.MkdirAll(t.BackupDir, 0755); err != nil {
+		return "", err
+	}
+
+	stamp := time.Now().Format("2006-01-02_150405")
+
+	for count := 0; ; count++ {
+		name := stamp + ".syx"
+		if count > 0 {
+			name = fmt.Sprintf("%s_%03d.syx", stamp, count)
+		}
+		fileName := filepath.Join(t.BackupDir, name)
+
+		file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		_, err = file.Write(bank.Raw)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", err
+		}
+
+		log("Backed up the internal memories to "+fileName, nil)
+
+		return fileName, nil
+	}
+}
+
+// Backups lists the bank backups in a folder, newest first.
+func Backups(dir string) ([]string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	backups := make([]string, 0)
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(strings.ToLower(file.Name()), ".syx") {
+			backups = append(backups, filepath.Join(dir, file.Name()))
+		}
+	}
+
+	// Timestamped names sort by age, counters after the time sort after the first of that second
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	return backups, nil
+}
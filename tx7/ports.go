@@ -0,0 +1,165 @@
+package tx7
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/murdinc/portmidi"
+	"github.com/murdinc/terminal"
+)
+
+const (
+	// InputEnv and OutputEnv hold the default MIDI ports when no flag is given.
+	InputEnv  = "TX7_MIDI_IN"
+	OutputEnv = "TX7_MIDI_OUT"
+)
+
+// Device is a MIDI port as listed by Discover, Index is what --in and --out accept.
+type Device struct {
+	Index     int    `json:"index"`
+	Name      string `json:"name"`
+	Interface string `json:"interface"`
+	Input     bool   `json:"input"`
+	Output    bool   `json:"output"`
+}
+
+// Devices lists every MIDI port portmidi knows about.
+func Devices() ([]Device, error) {
+	err := portmidi.Initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]Device, 0)
+
+	for i := 0; i < portmidi.CountDevices(); i++ {
+		info := portmidi.GetDeviceInfo(portmidi.DeviceId(i))
+		if info == nil {
+			continue
+		}
+
+		devices = append(devices, Device{
+			Index:     i + 1,
+			Name:      info.Name,
+			Interface: info.Interface,
+			Input:     info.IsInputAvailable,
+			Output:    info.IsOutputAvailable,
+		})
+	}
+
+	return devices, nil
+}
+
+// FindDevice resolves a port from its index or a case insensitive part of its name.
+func FindDevice(devices []Device, spec string, input bool) (portmidi.DeviceId, error) {
+	direction := "output"
+	if input {
+		direction = "input"
+	}
+
+	if index, err := strconv.Atoi(spec); err == nil {
+		for _, device := range devices {
+			if device.Index == index && ((input && device.Input) || (!input && device.Output)) {
+				return portmidi.DeviceId(device.Index - 1), nil
+			}
+		}
+		return 0, fmt.Errorf("No MIDI %s device with index %d!", direction, index)
+	}
+
+	matches := make([]Device, 0)
+	for _, device := range devices {
+		if (input && !device.Input) || (!input && !device.Output) {
+			continue
+		}
+		if strings.Contains(strings.ToLower(device.Name), strings.ToLower(spec)) {
+			matches = append(matches, device)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Errorf("No MIDI %s device matching [%s]!", direction, spec)
+	case 1:
+		return portmidi.DeviceId(matches[0].Index - 1), nil
+	}
+
+	names := make([]string, len(matches))
+	for i, device := range matches {
+		names[i] = fmt.Sprintf("%d: %s", device.Index, device.Name)
+	}
+	return 0, fmt.Errorf("MIDI %s [%s] is ambiguous, matches %s", direction, spec, strings.Join(names, ", "))
+}
+
+// Select resolves the input and output ports without prompting. Empty specs fall
+// back to the TX7_MIDI_IN and TX7_MIDI_OUT environment variables, and only a port
+// that is still missing after that is asked for.
+func Select(inputSpec string, outputSpec string) (input portmidi.DeviceId, output portmidi.DeviceId, err error) {
+	if inputSpec == "" {
+		inputSpec = os.Getenv(InputEnv)
+	}
+	if outputSpec == "" {
+		outputSpec = os.Getenv(OutputEnv)
+	}
+
+	devices, err := Devices()
+	if err != nil {
+		return
+	}
+
+	if len(devices) < 1 {
+		err = errors.New("No MIDI Device Detected!")
+		return
+	}
+
+	if inputSpec == "" {
+		input = promptDevice(devices, true)
+	} else if input, err = FindDevice(devices, inputSpec, true); err != nil {
+		return
+	}
+
+	if outputSpec == "" {
+		output = promptDevice(devices, false)
+	} else {
+		output, err = FindDevice(devices, outputSpec, false)
+	}
+
+	return
+}
+
+func Discover() (input portmidi.DeviceId, output portmidi.DeviceId, err error) {
+
+	devices, err := Devices()
+	if err != nil {
+		return
+	}
+
+	if len(devices) < 1 {
+		err = errors.New("No MIDI Device Detected!")
+		return
+	}
+
+	input = promptDevice(devices, true)
+	output = promptDevice(devices, false)
+
+	return
+}
+
+// promptDevice lists the input or output ports and asks which one to use.
+func promptDevice(devices []Device, input bool) portmidi.DeviceId {
+	for _, device := range devices {
+		if input && device.Input {
+			terminal.Response(fmt.Sprintf("[ %d ]		Input		%s", device.Index, device.Name))
+		}
+		if !input && device.Output {
+			terminal.Prompt(fmt.Sprintf("[ %d ]		Output		%s", device.Index, device.Name))
+		}
+	}
+
+	if input {
+		return portmidi.DeviceId(terminal.PromptInt("Please select the MIDI INPUT device:", portmidi.CountDevices()+1) - 1)
+	}
+	return portmidi.DeviceId(terminal.PromptInt("Please select the MIDI OUTPUT device:", portmidi.CountDevices()+1) - 1)
+}
@@ -0,0 +1,185 @@
+package tx7
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+const (
+	// VoiceDumpSize is the length of a single voice (VCED) dump, F0 through F7.
+	VoiceDumpSize = 163
+	// BankDumpSize is the length of a 32 voice (VMEM) dump, F0 through F7.
+	BankDumpSize = 4104
+)
+
+var (
+	// ErrInterrupted is returned when another MIDI message cuts a sysex dump short.
+	ErrInterrupted = errors.New("sysex dump interrupted by another MIDI message")
+)
+
+// HeaderError is returned for sysex messages that aren't a Yamaha voice or bank dump.
+type HeaderError struct {
+	Header []byte
+}
+
+func (e *HeaderError) Error() string {
+	return fmt.Sprintf("not a DX7 voice or bank dump, header: % X", e.Header)
+}
+
+// SizeError is returned when a dump is shorter or longer than its format requires.
+type SizeError struct {
+	Format   byte
+	Expected int
+	Got      int
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("sysex dump format 0x%.2X should be %d bytes, got %d", e.Format, e.Expected, e.Got)
+}
+
+// ChecksumError is returned when the checksum byte of a dump doesn't match its data.
+type ChecksumError struct {
+	Expected byte
+	Got      byte
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("sysex dump checksum should be 0x%.2X, got 0x%.2X", e.Expected, e.Got)
+}
+
+// Receiver reassembles voice and bank dumps from raw incoming MIDI bytes.
+// Realtime messages are dropped wherever they appear, and any number of dumps
+// can arrive back to back. Every complete dump is validated and handed to the
+// bank callback as a parsed Bank, problems are handed to the error callback.
+type Receiver struct {
+	bankCallback  func(bank parse.Bank)
+	errorCallback func(err error)
+
+	sysexMessage   []byte
+	sysexRecieving bool
+}
+
+// NewReceiver returns a Receiver that reports to the given callbacks, either may be nil.
+func NewReceiver(bankCallback func(bank parse.Bank), errorCallback func(err error)) *Receiver {
+	return &Receiver{bankCallback: bankCallback, errorCallback: errorCallback}
+}
+
+// Write feeds incoming MIDI bytes into the receiver.
+func (r *Receiver) Write(data []byte) {
+	for _, b := range data {
+
+		switch {
+
+		// Realtime messages can be interleaved anywhere, even inside sysex
+		case b >= 0xF8:
+			continue
+
+		case b == 0xF0:
+			if r.sysexRecieving {
+				r.fail(ErrInterrupted)
+			}
+			r.sysexRecieving = true
+			r.sysexMessage = []byte{b}
+
+		case b == 0xF7:
+			if !r.sysexRecieving {
+				continue
+			}
+			r.sysexMessage = append(r.sysexMessage, b)
+			r.sysexRecieving = false
+			r.complete(r.sysexMessage)
+			r.sysexMessage = nil
+
+		// Any other status byte ends a sysex message early
+		case b&0x80 != 0:
+			if r.sysexRecieving {
+				r.sysexRecieving = false
+				r.sysexMessage = nil
+				r.fail(ErrInterrupted)
+			}
+
+		default:
+			if !r.sysexRecieving {
+				continue
+			}
+			r.sysexMessage = append(r.sysexMessage, b)
+
+			// Nothing we understand is longer than a bank dump, stop buffering and
+			// let Validate say whether it was the wrong kind or the wrong size
+			if len(r.sysexMessage) > BankDumpSize {
+				r.sysexRecieving = false
+				r.fail(Validate(r.sysexMessage))
+				r.sysexMessage = nil
+			}
+		}
+	}
+}
+
+// Reset drops any partially received dump.
+func (r *Receiver) Reset() {
+	r.sysexRecieving = false
+	r.sysexMessage = nil
+}
+
+func (r *Receiver) complete(sysexMessage []byte) {
+	if err := Validate(sysexMessage); err != nil {
+		r.fail(err)
+		return
+	}
+
+	bank, err := parse.New(sysexMessage)
+	if err != nil {
+		r.fail(err)
+		return
+	}
+
+	if r.bankCallback != nil {
+		r.bankCallback(bank)
+	}
+}
+
+func (r *Receiver) fail(err error) {
+	if r.errorCallback != nil {
+		r.errorCallback(err)
+	}
+}
+
+// Validate checks the header, size and checksum of a complete voice or bank dump.
+func Validate(sysexMessage []byte) error {
+	if len(sysexMessage) < 6 || sysexMessage[0] != 0xF0 || sysexMessage[1] != 0x43 || sysexMessage[2]&0xF0 != 0x00 {
+		header := sysexMessage
+		if len(header) > 6 {
+			header = header[:6]
+		}
+		return &HeaderError{Header: header}
+	}
+
+	format := sysexMessage[3]
+
+	var expected int
+	switch format {
+	case 0x00:
+		expected = VoiceDumpSize
+	case 0x09:
+		expected = BankDumpSize
+	default:
+		return &HeaderError{Header: sysexMessage[:6]}
+	}
+
+	if len(sysexMessage) != expected {
+		return &SizeError{Format: format, Expected: expected, Got: len(sysexMessage)}
+	}
+
+	if size := int(sysexMessage[4])<<7 | int(sysexMessage[5]); size != expected-8 {
+		return &SizeError{Format: format, Expected: expected, Got: size + 8}
+	}
+
+	data := sysexMessage[6 : expected-2]
+	if sum := parse.Checksum(data); sum != sysexMessage[expected-2] {
+		return &ChecksumError{Expected: sum, Got: sysexMessage[expected-2]}
+	}
+
+	return nil
+}
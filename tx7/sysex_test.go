@@ -0,0 +1,190 @@
+package tx7
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// receive feeds data through a Receiver in chunks of size and collects what it reports.
+func receive(data []byte, size int) (banks []parse.Bank, errs []error) {
+	receiver := NewReceiver(
+		func(bank parse.Bank) { banks = append(banks, bank) },
+		func(err error) { errs = append(errs, err) },
+	)
+
+	for len(data) > 0 {
+		n := size
+		if n > len(data) {
+			n = len(data)
+		}
+		receiver.Write(data[:n])
+		data = data[n:]
+	}
+
+	return banks, errs
+}
+
+// withRealtime puts clock and active sensing bytes between the bytes of a message.
+func withRealtime(sysex []byte) []byte {
+	var data []byte
+	for i, b := range sysex {
+		switch i % 7 {
+		case 3:
+			data = append(data, 0xF8)
+		case 5:
+			data = append(data, 0xFE, 0xF8)
+		}
+		data = append(data, b)
+	}
+	return data
+}
+
+func TestReceiverRealtime(t *testing.T) {
+	voice := parse.InitVoice()
+	voice.Name = "REALTIME  "
+
+	for _, size := range []int{1, 3, 64, 4096} {
+		data := withRealtime(parse.VoiceSysex(voice))
+		data = append(data, withRealtime(parse.BankSysex([]parse.Voice{voice}))...)
+
+		banks, errs := receive(data, size)
+		if len(errs) > 0 {
+			t.Fatalf("chunks of %d: unexpected errors %v", size, errs)
+		}
+		if len(banks) != 2 {
+			t.Fatalf("chunks of %d: got %d dumps, expected 2", size, len(banks))
+		}
+		if banks[0].Format != 0x00 || banks[1].Format != 0x09 {
+			t.Errorf("chunks of %d: got formats 0x%.2X and 0x%.2X, expected a voice then a bank", size, banks[0].Format, banks[1].Format)
+		}
+		if name := banks[0].Voices[0].Name; name != voice.Name {
+			t.Errorf("chunks of %d: got voice [%s], expected [%s]", size, name, voice.Name)
+		}
+	}
+}
+
+func TestReceiverInterrupted(t *testing.T) {
+	sysex := parse.VoiceSysex(parse.InitVoice())
+
+	// A note on cuts the first dump short, the second arrives whole
+	data := append([]byte{}, sysex[:80]...)
+	data = append(data, 0x90, 60, 100)
+	data = append(data, sysex...)
+
+	banks, errs := receive(data, 16)
+	if len(errs) != 1 || !errors.Is(errs[0], ErrInterrupted) {
+		t.Fatalf("got errors %v, expected just ErrInterrupted", errs)
+	}
+	if len(banks) != 1 {
+		t.Errorf("got %d dumps, expected the one after the interruption", len(banks))
+	}
+
+	// A new dump starting before the last one ended
+	data = append(append([]byte{}, sysex[:80]...), sysex...)
+
+	banks, errs = receive(data, 16)
+	if len(errs) != 1 || !errors.Is(errs[0], ErrInterrupted) || len(banks) != 1 {
+		t.Errorf("got %d dumps and errors %v, expected one dump and ErrInterrupted", len(banks), errs)
+	}
+}
+
+func TestReceiverTruncated(t *testing.T) {
+	sysex := parse.VoiceSysex(parse.InitVoice())
+	data := append(append([]byte{}, sysex[:len(sysex)-20]...), 0xF7)
+
+	banks, errs := receive(withRealtime(data), 5)
+	if len(banks) != 0 || len(errs) != 1 {
+		t.Fatalf("got %d dumps and errors %v, expected a single error", len(banks), errs)
+	}
+
+	var sizeErr *SizeError
+	if !errors.As(errs[0], &sizeErr) {
+		t.Fatalf("got %v, expected a SizeError", errs[0])
+	}
+	if sizeErr.Format != 0x00 || sizeErr.Expected != VoiceDumpSize || sizeErr.Got != VoiceDumpSize-19 {
+		t.Errorf("got %+v, expected format 0x00, %d expected and %d got", sizeErr, VoiceDumpSize, VoiceDumpSize-19)
+	}
+}
+
+func TestReceiverOverlong(t *testing.T) {
+	data := []byte{0xF0, 0x43, 0x00, 0x09, 0x20, 0x00}
+	data = append(data, make([]byte, BankDumpSize)...)
+
+	banks, errs := receive(data, 256)
+	if len(banks) != 0 || len(errs) != 1 {
+		t.Fatalf("got %d dumps and errors %v, expected a single error", len(banks), errs)
+	}
+
+	var sizeErr *SizeError
+	if !errors.As(errs[0], &sizeErr) {
+		t.Errorf("got %v, expected a SizeError", errs[0])
+	}
+}
+
+func TestReceiverChecksum(t *testing.T) {
+	sysex := parse.BankSysex([]parse.Voice{parse.InitVoice()})
+	sum := sysex[len(sysex)-2]
+	sysex[len(sysex)-2] = (sum + 1) & 0x7F
+
+	banks, errs := receive(withRealtime(sysex), 128)
+	if len(banks) != 0 || len(errs) != 1 {
+		t.Fatalf("got %d dumps and errors %v, expected a single error", len(banks), errs)
+	}
+
+	var checksumErr *ChecksumError
+	if !errors.As(errs[0], &checksumErr) {
+		t.Fatalf("got %v, expected a ChecksumError", errs[0])
+	}
+	if checksumErr.Expected != sum || checksumErr.Got != (sum+1)&0x7F {
+		t.Errorf("got %+v, expected 0x%.2X and 0x%.2X", checksumErr, sum, (sum+1)&0x7F)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	voice := parse.VoiceSysex(parse.InitVoice())
+
+	otherMaker := append([]byte{}, voice...)
+	otherMaker[1] = 0x41
+
+	otherFormat := append([]byte{}, voice...)
+	otherFormat[3] = 0x03
+
+	badSize := append([]byte{}, voice...)
+	badSize[5] = 0x1C
+
+	tests := []struct {
+		name   string
+		sysex  []byte
+		expect interface{}
+	}{
+		{"voice", voice, nil},
+		{"bank", parse.BankSysex(nil), nil},
+		{"too short", []byte{0xF0, 0x43, 0xF7}, &HeaderError{}},
+		{"other maker", otherMaker, &HeaderError{}},
+		{"parameter change", parse.ParameterChange(1, 1), &HeaderError{}},
+		{"other format", otherFormat, &HeaderError{}},
+		{"wrong byte count", badSize, &SizeError{}},
+	}
+
+	for _, test := range tests {
+		err := Validate(test.sysex)
+		switch test.expect.(type) {
+		case nil:
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+		case *HeaderError:
+			var headerErr *HeaderError
+			if !errors.As(err, &headerErr) {
+				t.Errorf("%s: got %v, expected a HeaderError", test.name, err)
+			}
+		case *SizeError:
+			var sizeErr *SizeError
+			if !errors.As(err, &sizeErr) {
+				t.Errorf("%s: got %v, expected a SizeError", test.name, err)
+			}
+		}
+	}
+}
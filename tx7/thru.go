@@ -0,0 +1,80 @@
+package tx7
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/murdinc/portmidi"
+)
+
+// Thru forwards a controller keyboard to the synth, since the TX7 owns the MIDI ports.
+type Thru struct {
+	// Channel remaps everything to one MIDI channel (0 - 15), -1 keeps the controller's channels.
+	Channel int
+	// Transpose shifts notes and polyphonic aftertouch by semitones.
+	Transpose int
+}
+
+// StartThru opens the controller's input port and forwards note, CC, pitch bend and
+// aftertouch messages to the synth until ctx is done.
+func (t *TX7) StartThru(ctx context.Context, input portmidi.DeviceId, thru Thru) error {
+	if input == t.inputDevice {
+		return errors.New("the thru input can't be the port the synth sends dumps on")
+	}
+
+	stream, err := portmidi.NewInputStream(input, 1024)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer stream.Close()
+		for {
+			// Keep the polling tick short, this is live playing
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Millisecond):
+			}
+
+			events, err := stream.Read(1024)
+			if err != nil {
+				continue
+			}
+			for _, event := range events {
+				status, data1, data2, ok := thru.Message(event.Status, event.Data1, event.Data2)
+				if !ok {
+					continue
+				}
+				if err := t.writeShort(status, data1, data2); err != nil {
+					log("thru", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Message remaps and transposes one channel message, ok is false for anything that shouldn't be forwarded.
+func (thru Thru) Message(status, data1, data2 int64) (int64, int64, int64, bool) {
+	kind := status & 0xF0
+
+	switch kind {
+	case 0x80, 0x90, 0xA0: // note off, note on, polyphonic aftertouch
+		data1 += int64(thru.Transpose)
+		if data1 < 0 || data1 > 127 {
+			return 0, 0, 0, false
+		}
+	case 0xB0, 0xD0, 0xE0: // control change, channel aftertouch, pitch bend
+	default:
+		return 0, 0, 0, false
+	}
+
+	if thru.Channel >= 0 && thru.Channel <= 15 {
+		status = kind | int64(thru.Channel)
+	}
+
+	return status, data1, data2, true
+}
@@ -1,16 +1,31 @@
 package tx7
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
+	"sync"
 	"time"
 
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
 	"github.com/murdinc/portmidi"
-	"github.com/murdinc/terminal"
 )
 
 var (
 	tx7 *TX7
+
+	// ErrTimeout is returned when the synth does not answer a dump request in time.
+	ErrTimeout = errors.New("timed out waiting for a sysex dump from the synth")
+)
+
+const (
+	// DefaultTimeout is how long a single dump request waits for an answer.
+	DefaultTimeout = 5 * time.Second
+	// DefaultRetries is how many times a dump request is repeated after a timeout.
+	DefaultRetries = 2
+	// ParameterDelay spaces out parameter changes so the DX7's MIDI buffer doesn't overflow.
+	ParameterDelay = 10 * time.Millisecond
 )
 
 // TX7 represents a device with an input and output MIDI stream.
@@ -19,6 +34,25 @@ type TX7 struct {
 	outputDevice portmidi.DeviceId
 	inputStream  *portmidi.Stream
 	outputStream *portmidi.Stream
+
+	// outputLock keeps thru playing and sysex writes from interleaving on the output stream
+	outputLock sync.Mutex
+	// held tracks the notes we turned on and not off yet, by channel
+	held [16][128]bool
+
+	// Timeout and Retries apply to each dump request sent to the synth.
+	Timeout time.Duration
+	Retries int
+
+	// Channel is the MIDI channel (0 - 15) the synth receives on.
+	Channel byte
+
+	// Audition is the test phrase played by TestNotes after an upload.
+	Audition Audition
+
+	// BackupDir receives a copy of the internal voices before a bank upload
+	// overwrites them, backups are skipped when it is empty.
+	BackupDir string
 }
 
 func New(input portmidi.DeviceId, output portmidi.DeviceId) (*TX7, error) {
@@ -30,22 +64,27 @@ func New(input portmidi.DeviceId, output portmidi.DeviceId) (*TX7, error) {
 	if outStream, err = portmidi.NewOutputStream(output, 1024, 0); err != nil {
 		return nil, err
 	}
-	return &TX7{inputDevice: input, outputDevice: output, inputStream: inStream, outputStream: outStream}, nil
+	return &TX7{inputDevice: input, outputDevice: output, inputStream: inStream, outputStream: outStream, Timeout: DefaultTimeout, Retries: DefaultRetries, Audition: DefaultAudition}, nil
 }
 
+// Open opens whichever stream isn't open yet. The streams stay open for the life of
+// the TX7, so calling it again is harmless and never swaps a stream thru is writing to.
 func (t *TX7) Open() error {
+	t.outputLock.Lock()
+	defer t.outputLock.Unlock()
+
 	var err error
-	var inStream, outStream *portmidi.Stream
-	if inStream, err = portmidi.NewInputStream(t.inputDevice, 1024); err != nil {
-		return err
+	if t.inputStream == nil {
+		if t.inputStream, err = portmidi.NewInputStream(t.inputDevice, 1024); err != nil {
+			return err
+		}
 	}
-	if outStream, err = portmidi.NewOutputStream(t.outputDevice, 1024, 0); err != nil {
-		return err
+	if t.outputStream == nil {
+		if t.outputStream, err = portmidi.NewOutputStream(t.outputDevice, 1024, 0); err != nil {
+			return err
+		}
 	}
 
-	t.inputStream = inStream
-	t.outputStream = outStream
-
 	return nil
 
 }
@@ -58,7 +97,9 @@ func (t *TX7) Close() error {
 func (t *TX7) Read() (events []portmidi.Event, err error) {
 	var evts []portmidi.Event
 
-	t.Open()
+	if t.inputStream == nil {
+		return nil, errors.New("the MIDI input stream isn't open")
+	}
 
 	if evts, err = t.inputStream.Read(1024); err != nil {
 		return
@@ -70,183 +111,341 @@ func (t *TX7) Read() (events []portmidi.Event, err error) {
 
 // Listen listens the input stream for messages.
 func (t *TX7) Listen() <-chan portmidi.Event {
+	return t.ListenContext(context.Background())
+}
+
+// ListenContext listens the input stream for messages until ctx is done, then
+// stops polling and closes the returned channel.
+func (t *TX7) ListenContext(ctx context.Context) <-chan portmidi.Event {
 	ch := make(chan portmidi.Event)
 	go func(tx7 *TX7, ch chan portmidi.Event) {
+		defer close(ch)
 		for {
 			// sleep for a while before the new polling tick,
 			// otherwise operation is too intensive and blocking
-			time.Sleep(10 * time.Millisecond)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
 			events, err := tx7.Read()
 			if err != nil {
 				continue
 			}
 			for i := range events {
-				ch <- events[i]
+				select {
+				case ch <- events[i]:
+				case <-ctx.Done():
+					return
+				}
 			}
 		}
 	}(t, ch)
 	return ch
 }
 
-func (t *TX7) Upload(sysex []byte) {
+// Upload sends a voice or bank to the synth and plays the test notes. Before a bank
+// overwrites the internal voices they are backed up, and nothing is sent if that fails.
+func (t *TX7) Upload(sysex []byte) error {
 
-	err := portmidi.Initialize()
-	if err != nil {
-		return
-	}
+	bank := len(sysex) > 3 && sysex[3] == 0x09
 
-	fmt.Sprintf("%d %d", t.inputDevice, t.outputDevice)
-
-	t.Open()
+	if t.BackupDir != "" && bank {
+		if _, err := t.Backup(context.Background()); err != nil {
+			log("Backup", err)
+			return err
+		}
+	}
 
-	err = t.outputStream.WriteSysExBytes(portmidi.Time(), sysex)
+	err := t.Send(sysex)
 	if err != nil {
 		log("WriteSysEx", err)
+		return err
 	}
 
-	t.TestNotes()
+	if !bank || t.Audition.Banks {
+		t.TestNotes()
+	}
 
+	return nil
 }
 
-func (t *TX7) DownloadVoice(callback func(data []byte)) {
-	var sysexMessage []byte
+// Send writes a sysex message to the synth on its channel.
+func (t *TX7) Send(sysex []byte) error {
+	return t.sendAll([][]byte{sysex}, 0)
+}
 
-	t.Open()
+// Change turns the voice in the edit buffer, from, into to with parameter changes,
+// so notes that are playing keep playing through it.
+func (t *TX7) Change(from parse.Voice, to parse.Voice) error {
+	err := t.sendAll(parse.ParameterChanges(from, to), ParameterDelay)
+	if err != nil {
+		log("ParameterChange", err)
+	}
+	return err
+}
 
-	// Set up Listener
-	ch := t.Listen()
+// sendAll writes sysex messages one after another on the open output stream, waiting
+// delay between them. The lock is let go while waiting so thru keeps playing.
+func (t *TX7) sendAll(messages [][]byte, delay time.Duration) error {
+	if err := t.Open(); err != nil {
+		return err
+	}
 
-	sysexRecieving := false
-	sysexRequest := []byte{0xF0, 0x43, 0x20, 0x00, 0x00, 0xF7} // 1 voice
+	for i, sysex := range messages {
+		if i > 0 {
+			time.Sleep(delay)
+		}
 
-	t.outputStream.WriteSysExBytes(portmidi.Time(), sysexRequest)
+		// The synth ignores dumps that aren't on its channel
+		if len(sysex) > 2 && sysex[0] == 0xF0 {
+			sysex = append([]byte{}, sysex...)
+			sysex[2] = (sysex[2] & 0xF0) | (t.Channel & 0x0F)
+		}
 
-Loop:
-	for {
-		event := <-ch
+		t.outputLock.Lock()
+		err := t.outputStream.WriteSysExBytes(portmidi.Time(), sysex)
+		t.outputLock.Unlock()
+		if err != nil {
+			return err
+		}
+	}
 
-		// Start or continue recieving a sysex message
-		if sysexRecieving == true || event.Message[0] == 0xF0 {
-			sysexRecieving = true
+	return nil
+}
 
-			for i := 0; i < len(event.Message); i++ {
+// Store writes a voice into internal memory slot 1 - 32 by downloading the bank,
+// replacing the slot and sending the bank back. The bank as it was before is
+// saved in BackupDir first, nothing is sent if that fails. Memory protect has to be off.
+func (t *TX7) Store(ctx context.Context, voice parse.Voice, slot int) error {
+	if slot < 1 || slot > 32 {
+		return fmt.Errorf("slot must be 1 - 32, got %d", slot)
+	}
 
-				sysexMessage = append(sysexMessage, event.Message[i])
+	var original parse.Bank
+	err := t.DownloadBankContext(ctx, func(bank parse.Bank) {
+		original = bank
+	})
+	if err != nil {
+		return err
+	}
 
-				if event.Message[i] == 0xF7 {
-					sysexRecieving = false
+	if _, err := t.saveBackup(original); err != nil {
+		return err
+	}
 
-					callback(sysexMessage)
+	voices := make([]parse.Voice, len(original.Voices))
+	copy(voices, original.Voices)
+	voices[slot-1] = voice
 
-					break Loop
+	return t.Send(parse.BankSysex(voices))
+}
 
-				}
-			}
+// DownloadVoice requests the voice in the edit buffer and hands the parsed dump to callback.
+func (t *TX7) DownloadVoice(callback func(bank parse.Bank)) error {
+	return t.DownloadVoiceContext(context.Background(), callback)
+}
 
-		}
+// DownloadVoiceContext is DownloadVoice with cancellation, a per request timeout and retries.
+func (t *TX7) DownloadVoiceContext(ctx context.Context, callback func(bank parse.Bank)) error {
+	sysexRequest := []byte{0xF0, 0x43, 0x20 | t.Channel, 0x00, 0x00, 0xF7} // 1 voice
 
+	bank, err := t.request(ctx, sysexRequest)
+	if err != nil {
+		return err
 	}
 
-}
+	callback(bank)
 
-func (t *TX7) DownloadBank(callback func(data []byte)) {
+	return nil
+}
 
-	var sysexMessage []byte
+// DownloadBank requests all 32 internal voices and hands the parsed dump to callback.
+func (t *TX7) DownloadBank(callback func(bank parse.Bank)) error {
+	return t.DownloadBankContext(context.Background(), callback)
+}
 
-	t.Open()
+// DownloadBankContext is DownloadBank with cancellation, a per request timeout and retries.
+func (t *TX7) DownloadBankContext(ctx context.Context, callback func(bank parse.Bank)) error {
+	sysexRequest := []byte{0xF0, 0x43, 0x20 | t.Channel, 0x09, 0x00, 0xF7} // 32 voices
 
-	// Set up Listener
-	ch := t.Listen()
+	bank, err := t.request(ctx, sysexRequest)
+	if err != nil {
+		return err
+	}
 
-	sysexRecieving := false
-	sysexRequest := []byte{0xF0, 0x43, 0x20, 0x09, 0x00, 0xF7} // 32 voices
+	callback(bank)
 
-	t.outputStream.WriteSysEx(portmidi.Time(), string(sysexRequest))
+	return nil
+}
 
-Loop:
-	for {
-		event := <-ch
+// request sends a dump request, retrying up to t.Retries times when the synth doesn't answer
+// or the dump arrives damaged.
+func (t *TX7) request(ctx context.Context, sysexRequest []byte) (parse.Bank, error) {
+	var err error
+	var bank parse.Bank
 
-		// Start or continue recieving a sysex message
-		if sysexRecieving == true || event.Message[0] == 0xF0 {
-			sysexRecieving = true
+	for attempt := 0; attempt <= t.Retries; attempt++ {
+		if attempt > 0 {
+			log(fmt.Sprintf("Retrying dump request [ %d / %d ]", attempt, t.Retries), err)
+		}
 
-			for i := 0; i < len(event.Message); i++ {
+		bank, err = t.receive(ctx, sysexRequest)
+		if err == nil {
+			return bank, nil
+		}
 
-				sysexMessage = append(sysexMessage, event.Message[i])
+		// Don't retry once the caller has given up
+		if ctx.Err() != nil {
+			return parse.Bank{}, ctx.Err()
+		}
+	}
 
-				if event.Message[i] == 0xF7 {
-					sysexRecieving = false
+	return parse.Bank{}, err
+}
 
-					callback(sysexMessage)
+// receive sends a single dump request and waits up to t.Timeout for a valid dump in the requested format.
+func (t *TX7) receive(ctx context.Context, sysexRequest []byte) (parse.Bank, error) {
+	var bank parse.Bank
+	var received bool
+	var err error
 
-					break Loop
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
 
-				}
+	receiver := NewReceiver(
+		func(b parse.Bank) {
+			if b.Format == sysexRequest[3] {
+				bank = b
+				received = true
+			}
+		},
+		func(e error) {
+			// Sysex meant for other devices isn't our problem
+			if _, ok := e.(*HeaderError); !ok {
+				err = e
 			}
+		},
+	)
+
+	if err := t.Open(); err != nil {
+		return parse.Bank{}, err
+	}
+
+	// Set up Listener, it stops polling when we return
+	ch := t.ListenContext(ctx)
 
+	t.outputLock.Lock()
+	sendErr := t.outputStream.WriteSysExBytes(portmidi.Time(), sysexRequest)
+	t.outputLock.Unlock()
+	if sendErr != nil {
+		return parse.Bank{}, sendErr
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return parse.Bank{}, ErrTimeout
+		case event, ok := <-ch:
+			if !ok {
+				return parse.Bank{}, ErrTimeout
+			}
+			receiver.Write(event.Message)
 		}
 
+		if received {
+			return bank, nil
+		}
+		if err != nil {
+			return parse.Bank{}, err
+		}
 	}
 }
 
+// TestNotes plays the audition on the synth's channel.
 func (t *TX7) TestNotes() {
 
-	// note on events to play C# minor chord
-	err := t.outputStream.WriteShort(0x90, 60, 100)
+	events, err := t.Audition.events()
 	if err != nil {
 		log("testNotes", err)
+		return
 	}
-	t.outputStream.WriteShort(0x90, 64, 100)
-	t.outputStream.WriteShort(0x90, 67, 100)
 
-	time.Sleep(time.Second / 4)
+	start := time.Now()
+	for _, event := range events {
+		time.Sleep(time.Until(start.Add(event.At)))
 
-	// note off events
-	t.outputStream.WriteShort(0x80, 60, 100)
-	t.outputStream.WriteShort(0x80, 64, 100)
-	t.outputStream.WriteShort(0x80, 67, 100)
+		if event.On {
+			err = t.writeShort(0x90|int64(t.Channel), event.Note, event.Velocity)
+		} else {
+			err = t.writeShort(0x80|int64(t.Channel), event.Note, 64)
+		}
+		if err != nil {
+			log("testNotes", err)
+		}
+	}
 
 }
 
-func Discover() (input portmidi.DeviceId, output portmidi.DeviceId, err error) {
+// writeShort sends a channel message, safe to call alongside thru.
+func (t *TX7) writeShort(status, data1, data2 int64) error {
+	t.outputLock.Lock()
+	defer t.outputLock.Unlock()
 
-	err = portmidi.Initialize()
-	if err != nil {
-		return
+	if err := t.outputStream.WriteShort(status, data1, data2); err != nil {
+		return err
 	}
 
-	if portmidi.CountDevices() < 1 {
-		err = errors.New("No MIDI Device Detected!")
-		return
+	switch status & 0xF0 {
+	case 0x90:
+		t.held[status&0x0F][data1&0x7F] = data2 > 0
+	case 0x80:
+		t.held[status&0x0F][data1&0x7F] = false
 	}
 
-	for i := 0; i < portmidi.CountDevices(); i++ {
-		info := portmidi.GetDeviceInfo(portmidi.DeviceId(i))
+	return nil
+}
+
+// Panic silences the synth: a note off for every note we left playing, then All Sound Off
+// and All Notes Off on all 16 channels, since the DX7 only answers some of them.
+func (t *TX7) Panic() error {
+	t.outputLock.Lock()
+	defer t.outputLock.Unlock()
 
-		if info.IsInputAvailable {
-			terminal.Response(fmt.Sprintf("[ %d ]		Input		%s", i+1, info.Name))
-		}
-		if info.IsOutputAvailable {
-			terminal.Prompt(fmt.Sprintf("[ %d ]		Output		%s", i+1, info.Name))
+	if t.outputStream == nil {
+		return nil
+	}
+
+	var firstErr error
+	write := func(status, data1, data2 int64) {
+		if err := t.outputStream.WriteShort(status, data1, data2); err != nil && firstErr == nil {
+			firstErr = err
 		}
 	}
 
-	inputDevice := terminal.PromptInt("Please select the MIDI INPUT device:", portmidi.CountDevices()+1) - 1
-	outputDevice := terminal.PromptInt("Please select the MIDI OUTPUT device:", portmidi.CountDevices()+1) - 1
+	for channel := range t.held {
+		for note, on := range t.held[channel] {
+			if on {
+				write(0x80|int64(channel), int64(note), 0)
+				t.held[channel][note] = false
+			}
+		}
+	}
 
-	input = portmidi.DeviceId(inputDevice)
-	output = portmidi.DeviceId(outputDevice)
+	for channel := int64(0); channel < 16; channel++ {
+		write(0xB0|channel, 120, 0) // All Sound Off
+		write(0xB0|channel, 123, 0) // All Notes Off
+	}
 
-	return
+	return firstErr
 }
 
-// Log Function
+// Log Function, to stderr so it never mixes with data written to stdout
 ////////////////..........
 func log(kind string, err error) {
 	if err == nil {
-		fmt.Printf("  %s\n", kind)
+		fmt.Fprintf(os.Stderr, "  %s\n", kind)
 	} else {
-		fmt.Printf("[ERROR - %s]: %s\n", kind, err)
+		fmt.Fprintf(os.Stderr, "[ERROR - %s]: %s\n", kind, err)
 	}
 }
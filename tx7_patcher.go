@@ -1,10 +1,24 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/murdinc/MVRD_TX7_PATCHER/config"
+	"github.com/murdinc/MVRD_TX7_PATCHER/fourop"
+	"github.com/murdinc/MVRD_TX7_PATCHER/generate"
 	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+	"github.com/murdinc/MVRD_TX7_PATCHER/preview"
+	"github.com/murdinc/MVRD_TX7_PATCHER/synth"
 	"github.com/murdinc/MVRD_TX7_PATCHER/tx7"
 	"github.com/murdinc/MVRD_TX7_PATCHER/ui"
 	"github.com/murdinc/cli"
@@ -15,6 +29,12 @@ import (
 ////////////////..........
 func main() {
 
+	var err error
+	cfg, err = config.Load()
+	if err != nil {
+		log("Config", err)
+	}
+
 	app := cli.NewApp()
 	app.Name = "TX7 Patcher"
 	app.Version = "1.0"
@@ -37,10 +57,13 @@ func main() {
 			ShortName:   "t",
 			Description: "Parse all sysex files in a directory and test program",
 			Arguments: []cli.Argument{
-				{Name: "folder", Usage: "test /foldername", Description: "The name of the sysex folder to test against", Optional: false},
+				{Name: "folder", Usage: "test /foldername", Description: "The name of the sysex folder to test against, defaults to the configured folder", Optional: true},
 			},
 			Action: func(c *cli.Context) error {
-				library, _ := parse.OpenDir(c.NamedArg("folder"))
+				library, err := openLibrary(c)
+				if err != nil {
+					return err
+				}
 				/*
 					for _, bank := range library.Banks {
 
@@ -62,25 +85,59 @@ func main() {
 			ShortName:   "r",
 			Description: "Parse all sysex files in a directory and start program",
 			Arguments: []cli.Argument{
-				{Name: "folder", Usage: "run /foldername", Description: "The name of the sysex folder to run against", Optional: false},
+				{Name: "folder", Usage: "run /foldername", Description: "The name of the sysex folder to run against, defaults to the configured folder", Optional: true},
 			},
+			Flags: append([]cli.Flag{
+				cli.BoolFlag{Name: "offline", Usage: "Play a software rendered preview instead of sending voices to the synth"},
+				cli.StringFlag{Name: "pipe", Usage: "With --offline, write every preview WAV to this file or named pipe instead of playing it"},
+				cli.StringFlag{Name: "thru", Usage: "Forward a controller keyboard on this input port (index or name) to the synth"},
+				cli.IntFlag{Name: "thru-channel", Usage: "Remap the controller to this MIDI channel 1 - 16, 0 keeps its channels"},
+				cli.IntFlag{Name: "transpose", Usage: "Transpose the controller by this many semitones"},
+			}, synthFlags...),
 			Action: func(c *cli.Context) error {
-				library, _ := parse.OpenDir(c.NamedArg("folder"))
-
-				// Get device id's
-				input, output, err := tx7.Discover()
+				library, err := openLibrary(c)
 				if err != nil {
 					return err
 				}
 
-				synth, err := tx7.New(input, output)
+				if c.Bool("offline") {
+					player, err := preview.New(cfg.Player, c.String("pipe"), cfg.TestNotes)
+					if err != nil {
+						return err
+					}
+
+					ui.Start(interrupted, library, player, cfg.Colors, cfg.Mutate)
+					return nil
+				}
+
+				synth, err := connect(c)
 				if err != nil {
 					return err
 				}
 
-				synth.Open()
+				if spec := setting(c.String("thru"), cfg.Thru); spec != "" {
+					devices, err := tx7.Devices()
+					if err != nil {
+						return err
+					}
+					input, err := tx7.FindDevice(devices, spec, true)
+					if err != nil {
+						return err
+					}
+
+					channel := c.Int("thru-channel")
+					if channel < 0 || channel > 16 {
+						return fmt.Errorf("thru channel must be 1 - 16, or 0 to keep the controller's, got %d", channel)
+					}
+
+					ctx, cancel := context.WithCancel(interrupted)
+					defer cancel()
+					if err := synth.StartThru(ctx, input, tx7.Thru{Channel: channel - 1, Transpose: c.Int("transpose")}); err != nil {
+						return err
+					}
+				}
 
-				ui.Start(library, synth)
+				ui.Start(interrupted, library, synth, cfg.Colors, cfg.Mutate)
 				return nil
 			},
 		},
@@ -89,10 +146,13 @@ func main() {
 			ShortName:   "lvn",
 			Description: "List all voice names of all the sysex files in a directory",
 			Arguments: []cli.Argument{
-				{Name: "folder", Usage: "listVoiceNames /foldername", Description: "The name of the sysex folder to parse", Optional: false},
+				{Name: "folder", Usage: "listVoiceNames /foldername", Description: "The name of the sysex folder to parse, defaults to the configured folder", Optional: true},
 			},
 			Action: func(c *cli.Context) error {
-				library, _ := parse.OpenDir(c.NamedArg("folder"))
+				library, err := openLibrary(c)
+				if err != nil {
+					return err
+				}
 				library.DisplayVoiceNames()
 				return nil
 			},
@@ -104,85 +164,768 @@ func main() {
 			Arguments: []cli.Argument{
 				{Name: "sysex", Usage: "upload ./sysex/WEIRD1.SYX", Description: "The name of the sysex bank file to upload", Optional: false},
 			},
+			Flags: synthFlags,
 			Action: func(c *cli.Context) error {
 				sysex, _, _ := parse.Open(c.NamedArg("sysex"), &map[uint64]string{})
 
-				// Get device id's
-				input, output, err := tx7.Discover()
+				synth, err := connect(c)
+				if err != nil {
+					return err
+				}
+
+				return synth.Upload(sysex.Raw)
+			},
+		},
+		{
+			Name:        "store",
+			ShortName:   "s",
+			Description: "Store a voice from a sysex file into one of the 32 internal memories",
+			Arguments: []cli.Argument{
+				{Name: "sysex", Usage: "store ./sysex/WEIRD1.SYX 5 --voice 12", Description: "The name of the sysex file with the voice", Optional: false},
+				{Name: "slot", Usage: "store ./sysex/WEIRD1.SYX 5", Description: "The internal memory to overwrite, 1 - 32", Optional: false},
+			},
+			Flags: append([]cli.Flag{
+				cli.IntFlag{Name: "voice", Value: 1, Usage: "The voice in the sysex file to store"},
+				cli.BoolFlag{Name: "yes", Usage: "Don't ask for confirmation"},
+			}, synthFlags...),
+			Action: func(c *cli.Context) error {
+				bank, _, err := parse.Open(c.NamedArg("sysex"), nil)
 				if err != nil {
 					return err
 				}
 
-				synth, err := tx7.New(input, output)
+				number := c.Int("voice")
+				if number < 1 || number > len(bank.Voices) {
+					return fmt.Errorf("%s has no voice %d", c.NamedArg("sysex"), number)
+				}
+				voice := bank.Voices[number-1]
+
+				slot, err := strconv.Atoi(c.NamedArg("slot"))
+				if err != nil || slot < 1 || slot > 32 {
+					return fmt.Errorf("slot must be 1 - 32, got [%s]", c.NamedArg("slot"))
+				}
+
+				if !c.Bool("yes") && !terminal.PromptBool(fmt.Sprintf("Overwrite internal memory %d with [%s]?", slot, voice.Name)) {
+					return nil
+				}
+
+				synth, err := connect(c)
 				if err != nil {
 					return err
 				}
 
-				synth.Open()
+				err = synth.Store(interrupted, voice, slot)
+				if err != nil {
+					return err
+				}
 
-				synth.Upload(sysex.Raw)
+				log(fmt.Sprintf("Stored [%s] in internal memory %d", voice.Name, slot), nil)
 
 				return nil
 			},
 		},
 		{
-			Name:        "displayVoice",
-			ShortName:   "dv",
-			Description: "Download the currently selected voice and Display it",
+			Name:        "backups",
+			ShortName:   "bk",
+			Description: "List the backups of the internal memories, or restore one",
+			Arguments: []cli.Argument{
+				{Name: "action", Usage: "backups list", Description: "list or restore", Optional: true},
+				{Name: "backup", Usage: "backups restore 1", Description: "The number or file name of the backup to restore", Optional: true},
+			},
+			Flags: synthFlags,
 			Action: func(c *cli.Context) error {
+				backups, err := tx7.Backups(cfg.Backups)
+				if err != nil {
+					return err
+				}
 
-				callback := func(sysexBytes []byte) {
-					bank, _ := parse.New(sysexBytes)
-					bank.DisplayVoices()
+				switch c.NamedArg("action") {
+				case "", "list":
+					if len(backups) == 0 {
+						log("No backups in "+cfg.Backups, nil)
+					}
+					for i, backup := range backups {
+						log(fmt.Sprintf("[# %d]		%s", i+1, filepath.Base(backup)), nil)
+					}
+					return nil
+
+				case "restore":
+					backup := c.NamedArg("backup")
+					if number, err := strconv.Atoi(backup); err == nil {
+						if number < 1 || number > len(backups) {
+							return fmt.Errorf("No backup number %d, see: backups list", number)
+						}
+						backup = backups[number-1]
+					} else if _, err := os.Stat(backup); err != nil {
+						backup = filepath.Join(cfg.Backups, backup)
+					}
+
+					bank, _, err := parse.Open(backup, nil)
+					if err != nil {
+						return err
+					}
+					if bank.Format != 0x09 {
+						return fmt.Errorf("%s is not a 32 voice bank", backup)
+					}
+
+					if !terminal.PromptBool(fmt.Sprintf("Overwrite all 32 internal memories with %s?", filepath.Base(backup))) {
+						return nil
+					}
+
+					synth, err := connect(c)
+					if err != nil {
+						return err
+					}
+
+					return synth.Upload(bank.Raw)
+				}
+
+				return fmt.Errorf("Unknown backups action [%s], use list or restore", c.NamedArg("action"))
+			},
+		},
+		{
+			Name:        "render",
+			ShortName:   "rn",
+			Description: "Render a voice, or every voice in a folder, to WAV without the synth",
+			Arguments: []cli.Argument{
+				{Name: "sysex", Usage: "render bank.syx --voice 12 --note 60 --vel 100 --len 2s -o out.wav", Description: "The sysex file or folder to render", Optional: false},
+			},
+			Flags: []cli.Flag{
+				cli.IntFlag{Name: "voice", Value: 1, Usage: "The voice in the sysex file to render"},
+				cli.IntFlag{Name: "note", Value: 60, Usage: "The MIDI note to play"},
+				cli.StringFlag{Name: "notes", Usage: "Comma separated MIDI notes to play together, folders default to the configured test_notes"},
+				cli.IntFlag{Name: "vel", Value: 100, Usage: "The velocity to play with"},
+				cli.StringFlag{Name: "len", Value: "2s", Usage: "How long the key is held, the release is rendered after it"},
+				cli.StringFlag{Name: "o", Usage: "The WAV file to write, or the folder when rendering a folder"},
+			},
+			Action: func(c *cli.Context) error {
+				length, err := time.ParseDuration(c.String("len"))
+				if err != nil {
+					return err
 				}
 
-				// Get device id's
-				input, output, err := tx7.Discover()
+				source := c.NamedArg("sysex")
+				fi, err := os.Stat(source)
 				if err != nil {
 					return err
 				}
 
-				synth, err := tx7.New(input, output)
+				keys := []int{c.Int("note")}
+				if fi.IsDir() {
+					keys = cfg.TestNotes
+				}
+				if c.String("notes") != "" {
+					if keys, err = config.ParseNotes(c.String("notes")); err != nil {
+						return err
+					}
+				}
+				notes := synth.Chord(keys, c.Int("vel"), length)
+
+				if !fi.IsDir() {
+					bank, _, err := parse.Open(source, nil)
+					if err != nil {
+						return err
+					}
+
+					number := c.Int("voice")
+					if number < 1 || number > len(bank.Voices) {
+						return fmt.Errorf("%s has no voice %d", source, number)
+					}
+					voice := bank.Voices[number-1]
+
+					out := setting(c.String("o"), fileName(voice.Name)+".wav")
+					log(fmt.Sprintf("Rendering [%s] to %s", voice.Name, out), nil)
+
+					return synth.SaveWAV(out, synth.RenderNotes(voice, notes, synth.DefaultOptions), synth.DefaultSampleRate)
+				}
+
+				library, err := parse.OpenDirDedup(source, cfg.Dedup)
 				if err != nil {
 					return err
 				}
 
-				synth.Open()
+				folder := setting(c.String("o"), "wav")
+				if err := os.MkdirAll(folder, 0755); err != nil {
+					return err
+				}
+
+				for i, voice := range library.Voices() {
+					bankName := strings.TrimSuffix(filepath.Base(voice.BankFileName), filepath.Ext(voice.BankFileName))
+					out := filepath.Join(folder, fmt.Sprintf("%.4d_%s_%s.wav", i+1, fileName(bankName), fileName(voice.Name)))
+
+					if err := synth.SaveWAV(out, synth.RenderNotes(voice, notes, synth.DefaultOptions), synth.DefaultSampleRate); err != nil {
+						return err
+					}
+				}
 
-				synth.DownloadVoice(callback)
+				log(fmt.Sprintf("Rendered [ %d ] voices into %s", library.VoiceCount(), folder), nil)
 
 				return nil
 			},
 		},
 		{
-			Name:        "displayBank",
-			ShortName:   "db",
-			Description: "Download the bank and Display it",
+			Name:        "export",
+			ShortName:   "x",
+			Description: "Export a voice, a bank or the whole library as JSON, YAML, Dexed plugin state or a plain cartridge",
+			Arguments: []cli.Argument{
+				{Name: "sysex", Usage: "export bank.syx --voice 12 --format yaml -o voice.yaml", Description: "The sysex file or folder to export, defaults to the configured folder", Optional: true},
+			},
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "format", Value: "json", Usage: "json, yaml, dexed (plugin state XML), dexed-chunk (plugin state as a host saves it) or syx (32 voice cartridge)"},
+				cli.IntFlag{Name: "voice", Usage: "Only export this voice of the sysex file"},
+				cli.StringFlag{Name: "o", Usage: "The file to write, defaults to the terminal"},
+			},
 			Action: func(c *cli.Context) error {
+				export := parse.ExportJSON
+				switch c.String("format") {
+				case "json":
+				case "yaml", "yml":
+					export = parse.ExportYAML
+				case "dexed":
+					export = parse.DexedState
+				case "dexed-chunk":
+					export = parse.DexedChunk
+				case "syx":
+					export = func(voices []parse.Voice) ([]byte, error) {
+						if len(voices) > 32 {
+							return nil, fmt.Errorf("a bank holds 32 voices, got %d", len(voices))
+						}
+						return parse.BankSysex(voices), nil
+					}
+				default:
+					return fmt.Errorf("format must be json, yaml, dexed, dexed-chunk or syx, got [%s]", c.String("format"))
+				}
 
-				callback := func(sysexBytes []byte) {
-					bank, _ := parse.New(sysexBytes)
-					bank.DisplayVoices()
+				source := setting(c.NamedArg("sysex"), cfg.Folder)
+				if source == "" {
+					return errors.New("No sysex file or folder given, pass one or set a default with: config folder /foldername")
+				}
+				fi, err := os.Stat(source)
+				if err != nil {
+					return err
+				}
+
+				var voices []parse.Voice
+				if fi.IsDir() {
+					library, err := parse.OpenDirDedup(source, cfg.Dedup)
+					if err != nil {
+						return err
+					}
+					voices = library.Voices()
+				} else {
+					bank, _, err := parse.Open(source, nil)
+					if err != nil {
+						return err
+					}
+					voices = bank.Voices
+				}
+
+				if number := c.Int("voice"); number != 0 {
+					if fi.IsDir() {
+						return errors.New("--voice only works with a sysex file")
+					}
+					if number < 1 || number > len(voices) {
+						return fmt.Errorf("%s has no voice %d", source, number)
+					}
+					voices = voices[number-1 : number]
+				}
+
+				data, err := export(voices)
+				if err != nil {
+					return err
+				}
+
+				if c.String("o") == "" {
+					_, err = os.Stdout.Write(data)
+					return err
+				}
+
+				return os.WriteFile(c.String("o"), data, 0644)
+			},
+		},
+		{
+			Name:        "build",
+			ShortName:   "bd",
+			Description: "Build a single voice or 32 voice sysex file from voices written in JSON or YAML, or from Dexed plugin state",
+			Arguments: []cli.Argument{
+				{Name: "file", Usage: "build voices.yaml -o bank.syx", Description: "The JSON, YAML or Dexed state file to build, in the form written by export", Optional: false},
+			},
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "o", Usage: "The sysex file to write, defaults to the file name with .syx"},
+				cli.BoolFlag{Name: "bank", Usage: "Always build a 32 voice bank, even for a single voice"},
+			},
+			Action: func(c *cli.Context) error {
+				source := c.NamedArg("file")
+				data, err := os.ReadFile(source)
+				if err != nil {
+					return err
 				}
 
-				// Get device id's
-				input, output, err := tx7.Discover()
+				var voices []parse.Voice
+				if parse.IsDexedState(data) {
+					voices, err = parse.ImportDexed(data)
+				} else {
+					voices, err = parse.Import(data)
+				}
 				if err != nil {
+					return fmt.Errorf("%s:\n%s", source, err)
+				}
+				if len(voices) > 32 {
+					return fmt.Errorf("%s has %d voices, a bank holds 32", source, len(voices))
+				}
+
+				sysex := parse.VoiceSysex(voices[0])
+				if len(voices) > 1 || c.Bool("bank") {
+					sysex = parse.BankSysex(voices)
+				}
+
+				out := setting(c.String("o"), strings.TrimSuffix(source, filepath.Ext(source))+".syx")
+				if err := os.WriteFile(out, sysex, 0644); err != nil {
 					return err
 				}
 
-				synth, err := tx7.New(input, output)
+				log(fmt.Sprintf("Built [ %d ] voices into %s", len(voices), out), nil)
+				return nil
+			},
+		},
+		{
+			Name:        "convert",
+			ShortName:   "cv",
+			Description: "Convert DX7 voices to TX81Z / DX21 four operator voices, or the other way around",
+			Arguments: []cli.Argument{
+				{Name: "sysex", Usage: "convert bank.syx -o bank_4op.syx", Description: "The DX7 or four operator sysex file to convert", Optional: false},
+			},
+			Flags: []cli.Flag{
+				cli.IntFlag{Name: "voice", Usage: "Only convert this voice, into a single voice file"},
+				cli.StringFlag{Name: "o", Usage: "The sysex file to write, defaults to the file name with _4op or _dx7"},
+			},
+			Action: func(c *cli.Context) error {
+				source := c.NamedArg("sysex")
+				data, err := os.ReadFile(source)
 				if err != nil {
 					return err
 				}
+				base := strings.TrimSuffix(source, filepath.Ext(source))
+
+				pick := func(count int) (int, int, error) {
+					number := c.Int("voice")
+					if number == 0 {
+						return 0, count, nil
+					}
+					if number < 1 || number > count {
+						return 0, 0, fmt.Errorf("%s has no voice %d", source, number)
+					}
+					return number - 1, number, nil
+				}
+
+				report := func(name string, lost []string) {
+					if len(lost) == 0 {
+						return
+					}
+					terminal.Notice(fmt.Sprintf("%s lost:", name))
+					for _, l := range lost {
+						fmt.Printf("    %s\n", l)
+					}
+				}
+
+				var sysex []byte
+				var out string
+
+				if voices, err := fourop.Parse(data); err == nil {
+					from, to, err := pick(len(voices))
+					if err != nil {
+						return err
+					}
+
+					var converted []parse.Voice
+					for _, voice := range voices[from:to] {
+						dx7, lost := fourop.ToDX7(voice)
+						report(voice.Name, lost)
+						converted = append(converted, dx7)
+					}
+
+					sysex = parse.BankSysex(converted)
+					if len(converted) == 1 {
+						sysex = parse.VoiceSysex(converted[0])
+					}
+					out = base + "_dx7.syx"
+
+				} else {
+					bank, _, err := parse.Open(source, nil)
+					if err != nil {
+						return err
+					}
+					if len(bank.Voices) == 0 {
+						return fmt.Errorf("%s has no DX7 or four operator voices", source)
+					}
+					from, to, err := pick(len(bank.Voices))
+					if err != nil {
+						return err
+					}
+
+					var converted []fourop.Voice
+					for _, voice := range bank.Voices[from:to] {
+						four, lost := fourop.FromDX7(voice)
+						report(voice.Name, lost)
+						converted = append(converted, four)
+					}
+
+					sysex = fourop.BankSysex(converted)
+					if len(converted) == 1 {
+						sysex = fourop.VoiceSysex(converted[0])
+					}
+					out = base + "_4op.syx"
+				}
+
+				out = setting(c.String("o"), out)
+				if err := os.WriteFile(out, sysex, 0644); err != nil {
+					return err
+				}
 
-				synth.Open()
+				log("Converted into "+out, nil)
+				return nil
+			},
+		},
+		{
+			Name:        "show",
+			ShortName:   "sh",
+			Description: "Draw the algorithm of a voice, with the level and ratio of every operator",
+			Arguments: []cli.Argument{
+				{Name: "voice", Usage: "show e.piano.syx:3 --ascii", Description: "The voice, as file:voice, the voice defaults to 1", Optional: false},
+			},
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "ascii", Usage: "Draw with plain ASCII lines"},
+			},
+			Action: func(c *cli.Context) error {
+				voice, err := openVoice(c.NamedArg("voice"))
+				if err != nil {
+					return err
+				}
 
-				synth.DownloadBank(callback)
+				log(fmt.Sprintf("[%s] from [%s]", voice.Name, voice.BankFileName), nil)
+				for _, line := range voice.Diagram(c.Bool("ascii")) {
+					fmt.Printf("    %s\n", line)
+				}
 
 				return nil
 			},
 		},
+		{
+			Name:        "diff",
+			ShortName:   "df",
+			Description: "List every parameter that differs between two voices",
+			Arguments: []cli.Argument{
+				{Name: "a", Usage: "diff a.syx:3 b.syx:17", Description: "The first voice, as file:voice, the voice defaults to 1", Optional: false},
+				{Name: "b", Usage: "diff a.syx:3 b.syx:17", Description: "The second voice, as file:voice, the voice defaults to 1", Optional: false},
+			},
+			Action: func(c *cli.Context) error {
+				a, err := openVoice(c.NamedArg("a"))
+				if err != nil {
+					return err
+				}
+				b, err := openVoice(c.NamedArg("b"))
+				if err != nil {
+					return err
+				}
+
+				diffs := parse.Diff(a, b)
+				if len(diffs) == 0 {
+					log(fmt.Sprintf("[%s] and [%s] are identical", a.Name, b.Name), nil)
+					return nil
+				}
+
+				log(fmt.Sprintf("%d of %d parameters differ", len(diffs), parse.ParameterCount()), nil)
+				fmt.Printf("    %-36s %-12s %s\n", "", a.Name, b.Name)
+				for _, d := range diffs {
+					fmt.Printf("    %-36s %-12s %s\n", d.Field, d.A, d.B)
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:        "morph",
+			ShortName:   "mo",
+			Description: "Write a bank of voices morphing from one voice into another",
+			Arguments: []cli.Argument{
+				{Name: "a", Usage: "morph a.syx:3 b.syx:17 --steps 16 -o morph.syx", Description: "The voice to start from, as file:voice, the voice defaults to 1", Optional: false},
+				{Name: "b", Usage: "morph a.syx:3 b.syx:17", Description: "The voice to end on, as file:voice, the voice defaults to 1", Optional: false},
+			},
+			Flags: []cli.Flag{
+				cli.IntFlag{Name: "steps", Value: 32, Usage: "How many voices to write, 2 - 32, the first and last are the voices themselves"},
+				cli.StringFlag{Name: "o", Usage: "The sysex file to write, defaults to MORPH_<a>_<b>.syx"},
+			},
+			Action: func(c *cli.Context) error {
+				steps := c.Int("steps")
+				if steps < 2 || steps > 32 {
+					return fmt.Errorf("steps must be 2 - 32, got %d", steps)
+				}
+
+				a, err := openVoice(c.NamedArg("a"))
+				if err != nil {
+					return err
+				}
+				b, err := openVoice(c.NamedArg("b"))
+				if err != nil {
+					return err
+				}
+
+				out := setting(c.String("o"), fmt.Sprintf("MORPH_%s_%s.syx", fileName(a.Name), fileName(b.Name)))
+				if err := parse.WriteBank(out, generate.Steps(a, b, steps)); err != nil {
+					return err
+				}
+
+				log(fmt.Sprintf("Wrote %d steps from [%s] to [%s] into %s", steps, a.Name, b.Name, out), nil)
+				return nil
+			},
+		},
+		{
+			Name:        "random",
+			ShortName:   "rd",
+			Description: "Generate playable random voices into a bank file or straight to the synth",
+			Flags: append([]cli.Flag{
+				cli.IntFlag{Name: "count", Value: 32, Usage: "How many voices to generate, 1 - 32"},
+				cli.IntFlag{Name: "seed", Usage: "The seed to generate from, the same seed gives the same voices, defaults to a new one"},
+				cli.StringFlag{Name: "family", Usage: "The kind of voices to make: " + strings.Join(generate.Families, ", ") + ", defaults to a mix"},
+				cli.IntFlag{Name: "algorithm", Usage: "Use this algorithm 1 - 32, defaults to ones that suit the family"},
+				cli.StringFlag{Name: "o", Usage: "The sysex file to write, defaults to RANDOM_<seed>.syx unless sending"},
+				cli.BoolFlag{Name: "send", Usage: "Send the voices to the synth, one voice goes to the edit buffer and more to the internal memories"},
+				cli.BoolFlag{Name: "yes", Usage: "Don't ask before overwriting the internal memories"},
+			}, synthFlags...),
+			Action: func(c *cli.Context) error {
+				options := generate.RandomOptions{Family: c.String("family"), Algorithm: c.Int("algorithm")}
+				if err := options.Check(); err != nil {
+					return err
+				}
+
+				count := c.Int("count")
+				if count < 1 || count > 32 {
+					return fmt.Errorf("count must be 1 - 32, got %d", count)
+				}
+
+				seed := int64(c.Int("seed"))
+				if seed == 0 {
+					seed = generate.NewSeed()
+				}
+
+				voices := generate.Randoms(seed, count, options)
+
+				sysex := parse.BankSysex(voices)
+				if count == 1 {
+					sysex = parse.VoiceSysex(voices[0])
+				}
+
+				if out := c.String("o"); out != "" || !c.Bool("send") {
+					out = setting(out, fmt.Sprintf("RANDOM_%d.syx", seed))
+					if err := os.WriteFile(out, sysex, 0644); err != nil {
+						return err
+					}
+					log(fmt.Sprintf("Wrote %d random voices into %s", count, out), nil)
+				}
+
+				// A bank replaces all 32 internal memories, the rest with INIT VOICE
+				if c.Bool("send") && count > 1 && !c.Bool("yes") && !terminal.PromptBool(fmt.Sprintf("Overwrite all 32 internal memories with %d random voices?", count)) {
+					return nil
+				}
+
+				if c.Bool("send") {
+					synth, err := connect(c)
+					if err != nil {
+						return err
+					}
+					defer synth.Close()
+
+					if err := synth.Upload(sysex); err != nil {
+						return err
+					}
+					log(fmt.Sprintf("Sent %d random voices", count), nil)
+				}
+
+				terminal.Information(fmt.Sprintf("Seed %d, pass --seed %d to make these again", seed, seed))
+				return nil
+			},
+		},
+		{
+			Name:        "mutate",
+			ShortName:   "mu",
+			Description: "Write a bank of variations of a voice",
+			Arguments: []cli.Argument{
+				{Name: "voice", Usage: "mutate bank.syx:12 --amount 30 --scope eg -o variations.syx", Description: "The voice to vary, as file:voice, the voice defaults to 1", Optional: false},
+			},
+			Flags: []cli.Flag{
+				cli.IntFlag{Name: "amount", Usage: "How much to change, 1 - 100 percent, defaults to the configured mutate.amount"},
+				cli.StringFlag{Name: "scope", Usage: "What to change: " + strings.Join(generate.Scopes, ", ") + ", defaults to the configured mutate.scope"},
+				cli.IntFlag{Name: "count", Value: 32, Usage: "How many variations to make, 1 - 32"},
+				cli.IntFlag{Name: "seed", Usage: "The seed to vary from, the same seed gives the same variations, defaults to a new one"},
+				cli.StringFlag{Name: "o", Usage: "The sysex file to write, defaults to <voice>_VARIATIONS.syx"},
+			},
+			Action: func(c *cli.Context) error {
+				amount := cfg.Mutate.Amount
+				if c.Int("amount") != 0 {
+					amount = c.Int("amount")
+				}
+				if amount < 1 || amount > 100 {
+					return fmt.Errorf("amount must be 1 - 100, got %d", amount)
+				}
+
+				scope := setting(c.String("scope"), cfg.Mutate.Scope)
+				if err := generate.CheckScope(scope); err != nil {
+					return err
+				}
+
+				count := c.Int("count")
+				if count < 1 || count > 32 {
+					return fmt.Errorf("count must be 1 - 32, got %d", count)
+				}
+
+				seed := int64(c.Int("seed"))
+				if seed == 0 {
+					seed = generate.NewSeed()
+				}
+
+				voice, err := openVoice(c.NamedArg("voice"))
+				if err != nil {
+					return err
+				}
+
+				out := setting(c.String("o"), fileName(voice.Name)+"_VARIATIONS.syx")
+				if err := parse.WriteBank(out, generate.Variations(voice, count, float64(amount)/100, scope, seed)); err != nil {
+					return err
+				}
+
+				log(fmt.Sprintf("Wrote %d variations of [%s] into %s", count, voice.Name, out), nil)
+				terminal.Information(fmt.Sprintf("Seed %d, pass --seed %d to make these again", seed, seed))
+				return nil
+			},
+		},
+		{
+			Name:        "panic",
+			Description: "Send All Notes Off and All Sound Off on every MIDI channel to silence hanging notes",
+			Flags:       synthFlags,
+			Action: func(c *cli.Context) error {
+				synth, err := connect(c)
+				if err != nil {
+					return err
+				}
+				defer synth.Close()
+
+				if err := synth.Panic(); err != nil {
+					return err
+				}
+
+				terminal.Information("Sent all notes off")
+				return nil
+			},
+		},
+		{
+			Name:        "devices",
+			ShortName:   "d",
+			Description: "List the available MIDI devices",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "json", Usage: "Print the devices as JSON"},
+			},
+			Action: func(c *cli.Context) error {
+				devices, err := tx7.Devices()
+				if err != nil {
+					return err
+				}
+
+				if c.Bool("json") {
+					out, err := json.MarshalIndent(devices, "", "  ")
+					if err != nil {
+						return err
+					}
+					fmt.Println(string(out))
+					return nil
+				}
+
+				for _, device := range devices {
+					if device.Input {
+						log(fmt.Sprintf("[ %d ]		Input		%s", device.Index, device.Name), nil)
+					}
+					if device.Output {
+						log(fmt.Sprintf("[ %d ]		Output		%s", device.Index, device.Name), nil)
+					}
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:        "config",
+			ShortName:   "c",
+			Description: "Show or change the settings in the config file",
+			Arguments: []cli.Argument{
+				{Name: "key", Usage: "config channel", Description: "The setting to show or change", Optional: true},
+				{Name: "value", Usage: "config channel 2", Description: "The new value of the setting", Optional: true},
+			},
+			Action: func(c *cli.Context) error {
+				key := c.NamedArg("key")
+				value := c.NamedArg("value")
+
+				if key == "" {
+					log("Config file: "+config.Path(), nil)
+					for _, key := range config.Keys {
+						value, _ := cfg.Get(key)
+						log(fmt.Sprintf("%s = %s", key, value), nil)
+					}
+					return nil
+				}
+
+				if value == "" {
+					value, err := cfg.Get(key)
+					if err != nil {
+						return err
+					}
+					log(fmt.Sprintf("%s = %s", key, value), nil)
+					return nil
+				}
+
+				if err := cfg.Set(key, value); err != nil {
+					return err
+				}
+
+				return cfg.Save()
+			},
+		},
+		{
+			Name:        "displayVoice",
+			ShortName:   "dv",
+			Description: "Download the currently selected voice and Display it",
+			Flags:       synthFlags,
+			Action: func(c *cli.Context) error {
+
+				callback := func(bank parse.Bank) {
+					bank.DisplayVoices()
+				}
+
+				synth, err := connect(c)
+				if err != nil {
+					return err
+				}
+
+				return synth.DownloadVoice(callback)
+			},
+		},
+		{
+			Name:        "displayBank",
+			ShortName:   "db",
+			Description: "Download the bank and Display it",
+			Flags:       synthFlags,
+			Action: func(c *cli.Context) error {
+
+				callback := func(bank parse.Bank) {
+					bank.DisplayVoices()
+				}
+
+				synth, err := connect(c)
+				if err != nil {
+					return err
+				}
+
+				return synth.DownloadBank(callback)
+			},
+		},
 	}
 
 	log("TX7 Patcher - v1.2", nil)
@@ -192,12 +935,134 @@ func main() {
 	app.Run(os.Args)
 }
 
-// Log Function
+// Settings from the config file, loaded before any command runs
+var cfg config.Config
+
+// interrupted is done once the program is interrupted while connected to the synth.
+var interrupted = context.Background()
+
+// Flags shared by every command that talks to the synth, they override the config file
+var synthFlags = []cli.Flag{
+	cli.StringFlag{Name: "in", Usage: "MIDI input device index or name, defaults to $" + tx7.InputEnv + " or the config file"},
+	cli.StringFlag{Name: "out", Usage: "MIDI output device index or name, defaults to $" + tx7.OutputEnv + " or the config file"},
+	cli.IntFlag{Name: "channel", Usage: "MIDI channel of the synth (1 - 16), defaults to the config file"},
+}
+
+// Connect Function
+////////////////..........
+func connect(c *cli.Context) (*tx7.TX7, error) {
+
+	// Get device id's
+	input, output, err := tx7.Select(setting(c.String("in"), os.Getenv(tx7.InputEnv), cfg.Input), setting(c.String("out"), os.Getenv(tx7.OutputEnv), cfg.Output))
+	if err != nil {
+		return nil, err
+	}
+
+	synth, err := tx7.New(input, output)
+	if err != nil {
+		return nil, err
+	}
+
+	channel := cfg.Channel
+	if c.Int("channel") > 0 {
+		channel = c.Int("channel")
+	}
+	if channel < 1 || channel > 16 {
+		return nil, fmt.Errorf("MIDI channel must be 1 - 16, got %d", channel)
+	}
+	synth.Channel = byte(channel - 1)
+
+	synth.Audition = tx7.Audition{
+		Mode:     cfg.Audition.Mode,
+		Notes:    make([]int64, len(cfg.TestNotes)),
+		Velocity: int64(cfg.Audition.Velocity),
+		Length:   time.Duration(cfg.Audition.Length) * time.Millisecond,
+		File:     cfg.Audition.File,
+		Banks:    cfg.Audition.Banks,
+	}
+	for i, note := range cfg.TestNotes {
+		synth.Audition.Notes[i] = int64(note)
+	}
+
+	synth.BackupDir = cfg.Backups
+
+	// Don't leave notes hanging on the synth when we are killed, then let the
+	// command wind down so its deferred cleanup runs. A second signal kills.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	interrupted = ctx
+	go func() {
+		<-ctx.Done()
+		stop()
+		synth.Panic()
+	}()
+
+	return synth, nil
+}
+
+// Library Function
+////////////////..........
+func openLibrary(c *cli.Context) (parse.Library, error) {
+
+	folder := setting(c.NamedArg("folder"), cfg.Folder)
+	if folder == "" {
+		return parse.Library{}, errors.New("No sysex folder given, pass one or set a default with: config folder /foldername")
+	}
+
+	return parse.OpenDirDedup(folder, cfg.Dedup)
+}
+
+// openVoice opens one voice given as file:voice, like bank.syx:12. Without a voice number
+// it is the first voice of the file.
+func openVoice(arg string) (parse.Voice, error) {
+	file, number := arg, 1
+	if i := strings.LastIndex(arg, ":"); i > 0 {
+		if n, err := strconv.Atoi(arg[i+1:]); err == nil {
+			file, number = arg[:i], n
+		}
+	}
+
+	bank, _, err := parse.Open(file, nil)
+	if err != nil {
+		return parse.Voice{}, err
+	}
+	if number < 1 || number > len(bank.Voices) {
+		return parse.Voice{}, fmt.Errorf("%s has no voice %d", file, number)
+	}
+
+	return bank.Voices[number-1], nil
+}
+
+// fileName makes a voice or bank name safe to use in a file name
+func fileName(name string) string {
+	name = strings.TrimSpace(name)
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7E || strings.ContainsRune(`/\:*?"<>| `, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "voice"
+	}
+	return name
+}
+
+// setting returns the first value that was actually set
+func setting(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Log Function, to stderr so it never mixes with data written to stdout
 ////////////////..........
 func log(kind string, err error) {
 	if err == nil {
-		fmt.Printf("====> %s\n", kind)
+		fmt.Fprintf(os.Stderr, "====> %s\n", kind)
 	} else {
-		fmt.Printf("[ERROR - %s]: %s\n", kind, err)
+		fmt.Fprintf(os.Stderr, "[ERROR - %s]: %s\n", kind, err)
 	}
 }
@@ -0,0 +1,136 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+// BankBuilder holds the 32 slots of the bank being assembled from library voices.
+type BankBuilder struct {
+	Slots    [32]*parse.Voice
+	Cursor   int
+	swapFrom int
+}
+
+// NewBankBuilder returns an empty bank with the cursor on the first slot.
+func NewBankBuilder() *BankBuilder {
+	return &BankBuilder{swapFrom: -1}
+}
+
+// Add puts a voice into the slot under the cursor and moves on to the next slot.
+func (b *BankBuilder) Add(voice parse.Voice) {
+	b.Slots[b.Cursor] = &voice
+	if b.Cursor < len(b.Slots)-1 {
+		b.Cursor++
+	}
+}
+
+// Fill puts voices into the empty slots in order, leaving the slots already taken
+// alone, and returns how many it placed. The cursor goes to the first one placed.
+func (b *BankBuilder) Fill(voices []parse.Voice) int {
+	placed := 0
+	for i := range b.Slots {
+		if b.Slots[i] != nil || placed == len(voices) {
+			continue
+		}
+		if placed == 0 {
+			b.Cursor = i
+		}
+		voice := voices[placed]
+		b.Slots[i] = &voice
+		placed++
+	}
+	return placed
+}
+
+// Selected returns the voice in the slot under the cursor, nil if it is empty.
+func (b *BankBuilder) Selected() *parse.Voice {
+	return b.Slots[b.Cursor]
+}
+
+// Clear empties the slot under the cursor.
+func (b *BankBuilder) Clear() {
+	b.Slots[b.Cursor] = nil
+}
+
+// Up and Down move the cursor.
+func (b *BankBuilder) Up() {
+	if b.Cursor > 0 {
+		b.Cursor--
+	}
+}
+
+func (b *BankBuilder) Down() {
+	if b.Cursor < len(b.Slots)-1 {
+		b.Cursor++
+	}
+}
+
+// MoveUp and MoveDown reorder the bank by moving the slot under the cursor along with it.
+func (b *BankBuilder) MoveUp() {
+	if b.Cursor > 0 {
+		b.Slots[b.Cursor], b.Slots[b.Cursor-1] = b.Slots[b.Cursor-1], b.Slots[b.Cursor]
+		b.Cursor--
+	}
+}
+
+func (b *BankBuilder) MoveDown() {
+	if b.Cursor < len(b.Slots)-1 {
+		b.Slots[b.Cursor], b.Slots[b.Cursor+1] = b.Slots[b.Cursor+1], b.Slots[b.Cursor]
+		b.Cursor++
+	}
+}
+
+// Swap marks the slot under the cursor, the second call swaps it with the marked slot.
+func (b *BankBuilder) Swap() {
+	if b.swapFrom < 0 {
+		b.swapFrom = b.Cursor
+		return
+	}
+
+	b.Slots[b.Cursor], b.Slots[b.swapFrom] = b.Slots[b.swapFrom], b.Slots[b.Cursor]
+	b.swapFrom = -1
+}
+
+// Voices returns all 32 slots, empty ones filled with the INIT VOICE.
+func (b *BankBuilder) Voices() []parse.Voice {
+	voices := make([]parse.Voice, len(b.Slots))
+	for i, voice := range b.Slots {
+		if voice == nil {
+			voices[i] = parse.InitVoice()
+		} else {
+			voices[i] = *voice
+		}
+	}
+	return voices
+}
+
+// Sysex returns the bank as a 32 voice sysex message.
+func (b *BankBuilder) Sysex() []byte {
+	return parse.BankSysex(b.Voices())
+}
+
+// Items lists the slots for display, marking the cursor and a pending swap.
+func (b *BankBuilder) Items() []string {
+	items := make([]string, len(b.Slots))
+	for i, voice := range b.Slots {
+		name := "----------"
+		if voice != nil {
+			name = voice.Name
+		}
+
+		cursor := " "
+		if i == b.Cursor {
+			cursor = ">"
+		}
+		if i == b.swapFrom {
+			cursor += "*"
+		} else {
+			cursor += " "
+		}
+
+		items[i] = fmt.Sprintf("%s %.2d  %s", cursor, i+1, name)
+	}
+	return items
+}
@@ -0,0 +1,183 @@
+package ui
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+	"github.com/murdinc/MVRD_TX7_PATCHER/synth"
+)
+
+// graphWidth is how many characters wide the envelope charts are, two points each.
+const graphWidth = 76
+
+// brailleDots are the bits of the 2 x 4 dots in a braille character, top row first.
+var brailleDots = [4][2]rune{{0x01, 0x08}, {0x02, 0x10}, {0x04, 0x20}, {0x40, 0x80}}
+
+// operatorColors tell the operators apart when their EGs are drawn over each other.
+var operatorColors = []string{"fg-red", "fg-green", "fg-yellow", "fg-blue", "fg-magenta", "fg-cyan"}
+
+// BuildEnvelopeInfo plots the operator EGs and the pitch EG of a voice through a held
+// note and its release, one chart per operator or all six over each other.
+func BuildEnvelopeInfo(voice parse.Voice, overlay bool) string {
+
+	voiceString := fmt.Sprintf(" Name: %v\n", voice.Name)
+	voiceString += fmt.Sprintf(" Filename: %v\n\n", voice.BankFileName)
+
+	g := synth.Graph(voice, 2*graphWidth)
+	if len(g.Pitch) == 0 {
+		return voiceString
+	}
+
+	if overlay {
+		voiceString += " Operators  "
+		for op := 1; op <= 6; op++ {
+			voiceString += fmt.Sprintf(" [OP%d](%s)", op, operatorColors[op-1])
+		}
+		voiceString += "\n"
+		voiceString += BrailleChart(g.Operators[:], operatorColors, 32, 0, 1)
+		voiceString += graphAxis(g) + "\n"
+	} else {
+		topology := voice.Topology()
+		for op := 1; op <= 6; op++ {
+			o := voice.Operator(op)
+			part := "modulator"
+			if topology.IsCarrier(op) {
+				part = "[carrier](fg-bold)"
+			}
+			voiceString += fmt.Sprintf(" Operator %d  %s   Rates %d %d %d %d   Levels %d %d %d %d\n", op, part,
+				o.EGRate1, o.EGRate2, o.EGRate3, o.EGRate4, o.EGLevel1, o.EGLevel2, o.EGLevel3, o.EGLevel4)
+			voiceString += BrailleChart(g.Operators[op-1:op], nil, 5, 0, 1)
+		}
+		voiceString += graphAxis(g) + "\n"
+	}
+
+	// The pitch EG bends both ways from the middle, scaled to its widest bend
+	bend := 1.0
+	for _, semitones := range g.Pitch {
+		bend = math.Max(bend, math.Ceil(math.Abs(semitones)))
+	}
+	voiceString += fmt.Sprintf(" Pitch EG  +/- %.0f semitones   Rates %d %d %d %d   Levels %d %d %d %d\n", bend,
+		voice.PitchEGRate1, voice.PitchEGRate2, voice.PitchEGRate3, voice.PitchEGRate4,
+		voice.PitchEGLevel1, voice.PitchEGLevel2, voice.PitchEGLevel3, voice.PitchEGLevel4)
+	rows := 5
+	if overlay {
+		rows = 10
+	}
+	voiceString += BrailleChart([][]float64{g.Pitch}, nil, rows, -bend, bend)
+	voiceString += graphAxis(g) + "\n"
+
+	return voiceString
+
+}
+
+// BrailleChart draws series of points as lines of braille dots, two points across
+// and four down in every character, rows characters high from lo at the bottom to
+// hi at the top. Each series takes its color, if any, later series drawing over
+// earlier ones.
+func BrailleChart(series [][]float64, colors []string, rows int, lo float64, hi float64) string {
+	if len(series) == 0 || rows < 1 || hi <= lo {
+		return ""
+	}
+
+	width := (len(series[0]) + 1) / 2
+	height := rows * 4
+	cells := make([][]rune, rows)
+	cellColors := make([][]string, rows)
+	for i := range cells {
+		cells[i] = make([]rune, width)
+		cellColors[i] = make([]string, width)
+	}
+
+	for s, points := range series {
+		previous := -1
+		for x, value := range points {
+			y := int(math.Round((value - lo) / (hi - lo) * float64(height-1)))
+			y = maxInt(0, minInt(height-1, y))
+
+			// Join steep steps to the point before, so fast attacks draw a line
+			from, to := y, y
+			if previous >= 0 {
+				from, to = minInt(y, previous), maxInt(y, previous)
+			}
+			for dot := from; dot <= to; dot++ {
+				row := height - 1 - dot
+				cells[row/4][x/2] |= brailleDots[row%4][x%2]
+				if colors != nil {
+					cellColors[row/4][x/2] = colors[s%len(colors)]
+				}
+			}
+			previous = y
+		}
+	}
+
+	chart := ""
+	for i, row := range cells {
+		line := "  "
+		for j := 0; j < width; {
+			// Runs of the same color share one markup
+			k := j
+			for k < width && cellColors[i][k] == cellColors[i][j] {
+				k++
+			}
+			run := ""
+			for _, dots := range row[j:k] {
+				if dots == 0 {
+					run += " "
+				} else {
+					run += string(0x2800 + dots)
+				}
+			}
+			if cellColors[i][j] != "" {
+				run = fmt.Sprintf("[%s](%s)", run, cellColors[i][j])
+			}
+			line += run
+			j = k
+		}
+		chart += strings.TrimRight(line, " ") + "\n"
+	}
+
+	return chart
+}
+
+// graphAxis marks the start, the key release and the end of an envelope graph.
+func graphAxis(g synth.EnvelopeGraph) string {
+	width := (len(g.Pitch) + 1) / 2
+	release := g.Release / 2
+
+	line := []rune(strings.Repeat("─", width))
+	line[0] = '└'
+	if release > 0 && release < width {
+		line[release] = '┴'
+	}
+	axis := "  " + string(line) + "\n"
+
+	labels := []rune(strings.Repeat(" ", width))
+	copy(labels, []rune("0s"))
+	end := fmt.Sprintf("%.2fs", g.Duration().Seconds())
+	copy(labels[width-len(end):], []rune(end))
+	up := fmt.Sprintf("key up %.2fs", (g.Step * time.Duration(g.Release)).Seconds())
+	// The label starts at the release, or as close as it fits before the end
+	start := minInt(release, width-len(end)-len(up)-1)
+	if start > 2 {
+		copy(labels[start:], []rune(up))
+	}
+
+	return axis + "  " + string(labels) + "\n"
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
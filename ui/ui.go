@@ -1,20 +1,46 @@
 package ui
 
 import (
+	"context"
 	"fmt"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	ui "github.com/gizak/termui"
+	"github.com/murdinc/MVRD_TX7_PATCHER/config"
+	"github.com/murdinc/MVRD_TX7_PATCHER/generate"
 	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
-	"github.com/murdinc/MVRD_TX7_PATCHER/tx7"
 )
 
-func Start(l parse.Library, synth *tx7.TX7) {
+// Synth is where the TUI sends voices and banks, the TX7 itself or an offline preview.
+type Synth interface {
+	Upload(sysex []byte) error
+	Change(from parse.Voice, to parse.Voice) error
+	Panic() error
+	Close() error
+}
+
+// Start runs the TUI until it is quit or ctx is done.
+func Start(ctx context.Context, l parse.Library, synth Synth, colors config.Colors, mutate config.Mutate) {
 	if err := ui.Init(); err != nil {
 		panic(err)
 	}
 	defer ui.Close()
 	defer synth.Close()
+	defer synth.Panic()
+
+	// Leave the loop when interrupted, so the terminal is restored on the way out
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			ui.StopLoop()
+		case <-done:
+		}
+	}()
 
 	voiceList := l.Voices()
 	voiceCount := l.VoiceCount()
@@ -23,16 +49,16 @@ func Start(l parse.Library, synth *tx7.TX7) {
 	header := ui.NewPar(" ")
 	header.Height = 14
 	header.Width = 75
-	header.TextFgColor = ui.ColorWhite
+	header.TextFgColor = color(colors.Text)
 	header.BorderLabel = " MVRD_TX7_PATCHER "
-	header.BorderFg = ui.ColorWhite
-	header.BorderLabelFg = ui.ColorCyan
+	header.BorderFg = color(colors.Border)
+	header.BorderLabelFg = color(colors.Label)
 
 	// List of Voices
 	list := ui.NewList()
-	list.BorderLabelFg = ui.ColorCyan
-	list.ItemFgColor = ui.ColorYellow
-	list.BorderFg = ui.ColorWhite
+	list.BorderLabelFg = color(colors.Label)
+	list.ItemFgColor = color(colors.Items)
+	list.BorderFg = color(colors.Border)
 	list.Height = 52
 	list.Width = 75
 	list.Y = 14
@@ -40,27 +66,51 @@ func Start(l parse.Library, synth *tx7.TX7) {
 	// Information on right
 	info := ui.NewPar(" ")
 	info.Height = 66
-	info.Width = 124
-	info.TextFgColor = ui.ColorWhite
+	info.Width = 84
+	info.TextFgColor = color(colors.Text)
 	info.BorderLabel = " VOICE SETTINGS: "
-	info.BorderFg = ui.ColorWhite
-	info.BorderLabelFg = ui.ColorCyan
+	info.BorderFg = color(colors.Border)
+	info.BorderLabelFg = color(colors.Label)
 	info.Y = 0
 	info.X = 76
 
+	// Bank being built on the far right
+	bankList := ui.NewList()
+	bankList.BorderLabel = " BANK: "
+	bankList.BorderLabelFg = color(colors.Label)
+	bankList.ItemFgColor = color(colors.Items)
+	bankList.BorderFg = color(colors.Border)
+	bankList.Height = 66
+	bankList.Width = 40
+	bankList.Y = 0
+	bankList.X = 160
+
 	// Scroll Bar
 	scroll := ui.NewGauge()
 	scroll.Percent = 0
 	scroll.Width = 200
 	scroll.Height = 3
-	scroll.BarColor = ui.ColorRed
-	scroll.BorderFg = ui.ColorWhite
+	scroll.BarColor = color(colors.Scroll)
+	scroll.BorderFg = color(colors.Border)
 	scroll.Y = 66
 
 	listIndex := 0
 	selectedVoice := 0
 	search := false
 	searchStr := ""
+	bank := NewBankBuilder()
+	status := ""
+	var reference *parse.Voice
+	var sent *parse.Voice // the voice in the synth's edit buffer, if we know it
+	morph := 0            // percent of the way from the reference to the selected voice
+	var generated *parse.Voice
+	generatedAt := -1 // the random voice shows until the cursor moves
+	library := l      // l shows a bred generation while breeding
+	var session *generate.Session
+	viewing := 0      // the generation shown, 0 for the library
+	breeding := false // showing a generation instead of the library
+	starred := map[string]parse.Voice{}
+	envelopes := 0 // 0 shows the settings, 1 the EG of every operator, 2 all of them overlaid
 
 	// Build output
 	draw := func(listIndex int, selectedVoice int, sendVoice bool, search bool, searchStr string) {
@@ -71,6 +121,11 @@ func Start(l parse.Library, synth *tx7.TX7) {
 			header.Text += " < \n\n	Search Mode! Press ESC to exit."
 		} else {
 			header.Text += fmt.Sprintf("\n\n Selected Voice: %d", selectedVoice+1)
+			if session != nil && selectedVoice < len(voiceList) {
+				if parents := session.ParentNames(voiceList[selectedVoice]); len(parents) > 0 {
+					header.Text += "   Bred from " + strings.Join(parents, " x ")
+				}
+			}
 		}
 
 		if l.SearchStr != searchStr {
@@ -91,9 +146,37 @@ func Start(l parse.Library, synth *tx7.TX7) {
 			}
 
 			strs := VoiceNames(l)
+			for i, voice := range voiceList {
+				if _, ok := starred[starKey(voice)]; ok && i < len(strs) {
+					strs[i] = "*" + strs[i][1:]
+				}
+			}
 
 			if selectedVoice >= 0 && selectedVoice < len(voiceList) && selectedVoice < len(strs) {
-				info.Text = BuildVoiceInfo(voiceList[selectedVoice])
+				if sendVoice == true || generatedAt != selectedVoice {
+					generatedAt = -1
+				}
+
+				voiceInfo := func(voice parse.Voice) string {
+					if envelopes > 0 {
+						return BuildEnvelopeInfo(voice, envelopes == 2)
+					}
+					return BuildVoiceInfo(voice)
+				}
+
+				if generated != nil && generatedAt >= 0 {
+					info.BorderLabel = " RANDOM VOICE: "
+					info.Text = voiceInfo(*generated)
+				} else if reference != nil {
+					info.BorderLabel = " COMPARE: "
+					info.Text = MorphSlider(morph) + BuildCompareInfo(*reference, voiceList[selectedVoice])
+				} else {
+					info.BorderLabel = " VOICE SETTINGS: "
+					if envelopes > 0 {
+						info.BorderLabel = " ENVELOPES: "
+					}
+					info.Text = voiceInfo(voiceList[selectedVoice])
+				}
 
 				voices := strs[listIndex:selectedVoice]
 				voices = append(voices, fmt.Sprintf(">%s", strs[selectedVoice]))
@@ -105,7 +188,10 @@ func Start(l parse.Library, synth *tx7.TX7) {
 			// Send Voice !
 			if sendVoice == true {
 				sysex := l.BuildSysex(selectedVoice)
-				synth.Upload(sysex)
+				if synth.Upload(sysex) == nil {
+					voice := voiceList[selectedVoice]
+					sent = &voice
+				}
 			}
 
 		} else {
@@ -113,8 +199,37 @@ func Start(l parse.Library, synth *tx7.TX7) {
 		}
 
 		list.BorderLabel = fmt.Sprintf(" VOICES: [ %d ] in [ %d ] Banks ( [%d] Duplicate Voices ) ", voiceCount, l.FileCount, l.Duplicates)
+		if breeding {
+			list.BorderLabel = fmt.Sprintf(" GENERATION %d of %d: [ %d ] Voices, [ %d ] Starred ", viewing, session.Generation, voiceCount, len(starred))
+		}
 
-		ui.Render(header, list, info, scroll)
+		bankList.Items = append(bank.Items(), "",
+			" 'A' add voice to slot",
+			" '[' ']' select slot",
+			" '{' '}' move slot",
+			" 'W' twice to swap slots",
+			" 'X' clear slot",
+			" Shift 'S' save bank .syx",
+			" Shift 'U' send bank to synth",
+			"",
+			" 'R' pin voice to compare",
+			" Shift 'R' unpin voice",
+			" ',' '.' morph pinned to selected",
+			" 'G' send a random voice",
+			" Shift 'G' add it to slot",
+			" 'V' fill empty slots with variations",
+			" Shift 'V' variation scope: "+mutate.Scope,
+			" 'T' play slot",
+			" Shift 'E' envelopes / overlay",
+			"",
+			" 'F' star voice as a parent",
+			" 'O' breed the starred voices",
+			" Shift 'O' step through generations",
+			"",
+			" '!' panic, all notes off",
+			"", " "+status)
+
+		ui.Render(header, list, info, bankList, scroll)
 	}
 
 	draw(listIndex, selectedVoice, false, search, searchStr)
@@ -298,6 +413,280 @@ func Start(l parse.Library, synth *tx7.TX7) {
 		}
 	})
 
+	// Command keys, typed into the search instead while searching
+	commandKey := func(key string, action func()) {
+		ui.Handle("/sys/kbd/"+key, func(ui.Event) {
+			if search == true {
+				searchStr += key
+			} else {
+				status = ""
+				action()
+			}
+			draw(listIndex, selectedVoice, false, search, searchStr)
+		})
+	}
+
+	// A - Add the selected voice to the bank
+	commandKey("a", func() {
+		if voiceCount > 0 {
+			bank.Add(voiceList[selectedVoice])
+		}
+	})
+
+	// [ ] - Select slot
+	commandKey("[", bank.Up)
+	commandKey("]", bank.Down)
+
+	// { } - Move slot
+	commandKey("{", bank.MoveUp)
+	commandKey("}", bank.MoveDown)
+
+	// W - Swap slots
+	commandKey("w", bank.Swap)
+
+	// X - Clear slot
+	commandKey("x", bank.Clear)
+
+	// Shift S - Save bank
+	commandKey("S", func() {
+		fileName := filepath.Join(l.FolderName, time.Now().Format("BANK_20060102_150405.syx"))
+		if err := parse.WriteBank(fileName, bank.Voices()); err != nil {
+			status = fmt.Sprintf("Save failed: %s", err)
+		} else {
+			status = "Saved " + filepath.Base(fileName)
+		}
+	})
+
+	// Shift U - Send bank to the synth
+	commandKey("U", func() {
+		sent = nil
+		if err := synth.Upload(bank.Sysex()); err != nil {
+			status = fmt.Sprintf("Send failed: %s", err)
+		} else {
+			status = "Sent bank to synth"
+		}
+	})
+
+	// R - Pin the selected voice as the reference to compare against
+	commandKey("r", func() {
+		if voiceCount > 0 {
+			pinned := voiceList[selectedVoice]
+			reference = &pinned
+			morph = 0
+			status = "Comparing against " + pinned.Name
+		}
+	})
+
+	// Shift R - Unpin the reference voice
+	commandKey("R", func() {
+		reference = nil
+	})
+
+	// , . - Slide the morph between the pinned and the selected voice, streaming
+	// the changes to the synth so held notes morph along
+	slide := func(step int) {
+		if reference == nil || voiceCount == 0 {
+			status = "Pin a voice with 'R' to morph from"
+			return
+		}
+
+		morph += step
+		if morph < 0 {
+			morph = 0
+		}
+		if morph > 100 {
+			morph = 100
+		}
+
+		next := generate.Morph(*reference, voiceList[selectedVoice], float64(morph)/100)
+
+		var err error
+		if sent == nil {
+			err = synth.Upload(parse.VoiceSysex(next))
+		} else {
+			err = synth.Change(*sent, next)
+		}
+		if err != nil {
+			status = fmt.Sprintf("Morph failed: %s", err)
+			sent = nil
+			return
+		}
+		sent = &next
+	}
+	commandKey(",", func() { slide(-10) })
+	commandKey(".", func() { slide(10) })
+
+	// G - Send a random voice
+	commandKey("g", func() {
+		seed := generate.NewSeed()
+		voice := generate.Randoms(seed, 1, generate.RandomOptions{})[0]
+		if err := synth.Upload(parse.VoiceSysex(voice)); err != nil {
+			status = fmt.Sprintf("Send failed: %s", err)
+			return
+		}
+		generated, generatedAt, sent = &voice, selectedVoice, &voice
+		status = fmt.Sprintf("Sent [%s] seed %d", voice.Name, seed)
+	})
+
+	// Shift G - Add the random voice to the bank
+	commandKey("G", func() {
+		if generated != nil {
+			bank.Add(*generated)
+		}
+	})
+
+	// V - Fill the empty bank slots with variations of the selected voice and play the first
+	commandKey("v", func() {
+		if voiceCount == 0 {
+			return
+		}
+		seed := generate.NewSeed()
+		voices := generate.Variations(voiceList[selectedVoice], 32, float64(mutate.Amount)/100, mutate.Scope, seed)
+		placed := bank.Fill(voices)
+		if placed == 0 {
+			status = "The bank is full, empty slots with 'x' to make room"
+			return
+		}
+		if err := synth.Upload(parse.VoiceSysex(voices[0])); err != nil {
+			status = fmt.Sprintf("Send failed: %s", err)
+			return
+		}
+		sent = &voices[0]
+		status = fmt.Sprintf("%d variations, %d%% %s", placed, mutate.Amount, mutate.Scope)
+	})
+
+	// Shift V - Change what the variations touch
+	commandKey("V", func() {
+		for i, scope := range generate.Scopes {
+			if scope == mutate.Scope {
+				mutate.Scope = generate.Scopes[(i+1)%len(generate.Scopes)]
+				return
+			}
+		}
+		mutate.Scope = generate.ScopeAll
+	})
+
+	// T - Play the voice in the selected slot
+	commandKey("t", func() {
+		voice := bank.Selected()
+		if voice == nil {
+			return
+		}
+		if err := synth.Upload(parse.VoiceSysex(*voice)); err != nil {
+			status = fmt.Sprintf("Send failed: %s", err)
+			return
+		}
+		played := *voice
+		sent = &played
+		status = "Playing " + voice.Name
+	})
+
+	// Show a library, the whole one or a bred generation
+	show := func(lib parse.Library, isGeneration bool) {
+		l, breeding = lib, isGeneration
+		search, searchStr = false, ""
+		l.Search("")
+		voiceList = l.Voices()
+		voiceCount = l.VoiceCount()
+		selectedVoice, listIndex = 0, 0
+	}
+
+	// F - Star the selected voice as a parent of the next generation
+	commandKey("f", func() {
+		if voiceCount == 0 {
+			return
+		}
+		voice := voiceList[selectedVoice]
+		key := starKey(voice)
+
+		_, star := starred[key]
+		star = !star
+		if star {
+			starred[key] = voice
+		} else {
+			delete(starred, key)
+		}
+
+		if session != nil {
+			if err := session.Star(voice, star); err != nil {
+				status = fmt.Sprintf("Lineage failed: %s", err)
+				return
+			}
+		}
+		status = fmt.Sprintf("%d starred", len(starred))
+	})
+
+	// O - Breed a generation from the starred voices
+	commandKey("o", func() {
+		if len(starred) < 2 {
+			status = "Star two or more voices with 'F'"
+			return
+		}
+
+		keys := make([]string, 0, len(starred))
+		for key := range starred {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		parents := make([]parse.Voice, len(keys))
+		for i, key := range keys {
+			parents[i] = starred[key]
+		}
+
+		if session == nil {
+			dir := filepath.Join(library.FolderName, "breeding")
+			session = generate.NewSession(dir, float64(mutate.Amount)/100, mutate.Scope, generate.NewSeed())
+		}
+
+		children, err := session.Breed(parents, 32)
+		if err != nil {
+			status = fmt.Sprintf("Breeding failed: %s", err)
+			return
+		}
+
+		viewing = session.Generation
+		starred = map[string]parse.Voice{}
+		show(parse.NewLibrary(library.FolderName, children), true)
+		status = fmt.Sprintf("Bred generation %d", session.Generation)
+	})
+
+	// Shift O - Step through the generations of the session, then back to the library
+	commandKey("O", func() {
+		if session == nil {
+			status = "Breed a generation with 'O' first"
+			return
+		}
+
+		viewing = (viewing + 1) % (session.Generation + 1)
+		if viewing == 0 {
+			show(library, false)
+			return
+		}
+
+		bank, _, err := parse.Open(session.Bank(viewing), nil)
+		if err != nil {
+			status = fmt.Sprintf("Reading generation %d failed: %s", viewing, err)
+			viewing = 0
+			show(library, false)
+			return
+		}
+		show(parse.NewLibrary(library.FolderName, bank.Voices), true)
+	})
+
+	// Shift E - Settings, envelope graphs, envelopes overlaid
+	commandKey("E", func() {
+		envelopes = (envelopes + 1) % 3
+	})
+
+	// ! - Panic, silence hanging notes
+	commandKey("!", func() {
+		if err := synth.Panic(); err != nil {
+			status = fmt.Sprintf("Panic failed: %s", err)
+		} else {
+			status = "Sent all notes off"
+		}
+	})
+
 	ui.Loop()
 
 }
@@ -305,27 +694,30 @@ func Start(l parse.Library, synth *tx7.TX7) {
 func BuildVoiceInfo(voice parse.Voice) string {
 
 	voiceString := fmt.Sprintf(" Name: %v\n", voice.Name)
-	voiceString += fmt.Sprintf(" Filename: %v\n", voice.BankFileName)
+	voiceString += fmt.Sprintf(" Filename: %v\n\n", voice.BankFileName)
+
+	for _, line := range voice.Diagram(false) {
+		voiceString += fmt.Sprintf(" %s\n", line)
+	}
+	voiceString += "\n"
 
 	// Start Operators
-	for n, operator := range voice.Operators {
+	for op := 1; op <= 6 && len(voice.Operators) == 6; op++ {
+		operator := voice.Operator(op)
 
-		voiceString += fmt.Sprintf("		Operator %d\n", n+1)
+		voiceString += fmt.Sprintf("		Operator %d\n", op)
 
 		voiceString += fmt.Sprintf("				EGRate1: %.3d		EGLevel1: %.3d		ScaleLeftDepth:  %.3d", operator.EGRate1, operator.EGLevel1, operator.ScaleLeftDepth)
-		voiceString += fmt.Sprintf("				LevelScalingBreakPoint: %.2d			AmplitudeModulationSensitivity: %d\n", operator.LevelScalingBreakPoint, operator.AmplitudeModulationSensitivity)
+		voiceString += fmt.Sprintf("				LevelScalingBreakPoint: %-3s			AmplitudeModulationSensitivity: %d\n", parse.BreakPointText(operator.LevelScalingBreakPoint), operator.AmplitudeModulationSensitivity)
 
 		voiceString += fmt.Sprintf("				EGRate2: %.3d		EGLevel2: %.3d		ScaleRightDepth: %.3d", operator.EGRate2, operator.EGLevel2, operator.ScaleRightDepth)
 		voiceString += fmt.Sprintf("				RateScale: %d																	KeyVelocitySensitivity: %d\n", operator.RateScale, operator.KeyVelocitySensitivity)
 
-		voiceString += fmt.Sprintf("				EGRate3: %.3d		EGLevel3: %.3d		ScaleLeftCurve:  %.3d", operator.EGRate3, operator.EGLevel3, operator.ScaleLeftCurve)
-		voiceString += fmt.Sprintf("				RateScale: %d																	KeyVelocitySensitivity: %d\n", operator.RateScale, operator.KeyVelocitySensitivity)
-
-		voiceString += fmt.Sprintf("				EGRate4: %.3d		EGLevel4: %.3d		ScaleRightCurve: %.3d", operator.EGRate4, operator.EGLevel4, operator.ScaleRightCurve)
-		voiceString += fmt.Sprintf("				Detune: %.2d																			OutputLevel: %d\n", operator.Detune, operator.OutputLevel)
+		voiceString += fmt.Sprintf("				EGRate3: %.3d		EGLevel3: %.3d		ScaleLeftCurve:  %s", operator.EGRate3, operator.EGLevel3, parse.CurveText(operator.ScaleLeftCurve))
+		voiceString += fmt.Sprintf("				Detune: %-2s																			OutputLevel: %d\n", parse.DetuneText(operator.Detune), operator.OutputLevel)
 
-		voiceString += fmt.Sprintf("                                                         FrequencyCoarse: %.2d          OscillatorMode: %d\n", operator.FrequencyCoarse, operator.OscillatorMode)
-		voiceString += fmt.Sprintf("                                                         FrequencyFine: %.2d\n\n", operator.FrequencyFine)
+		voiceString += fmt.Sprintf("				EGRate4: %.3d		EGLevel4: %.3d		ScaleRightCurve: %s", operator.EGRate4, operator.EGLevel4, parse.CurveText(operator.ScaleRightCurve))
+		voiceString += fmt.Sprintf("				Frequency: %-9s		(%.2d / %.2d)		OscillatorMode: %s\n\n", operator.FrequencyText(), operator.FrequencyCoarse, operator.FrequencyFine, parse.ModeText(operator.OscillatorMode))
 
 	}
 	// End Operators
@@ -336,19 +728,139 @@ func BuildVoiceInfo(voice parse.Voice) string {
 	voiceString += fmt.Sprintf("			PitchEGRate3: %.2d		PitchEGLevel3: %.2d\n", voice.PitchEGRate3, voice.PitchEGLevel3)
 	voiceString += fmt.Sprintf("			PitchEGRate4: %.2d		PitchEGLevel4: %.2d\n\n", voice.PitchEGRate4, voice.PitchEGLevel4)
 
-	voiceString += fmt.Sprintf("			Algorithm: %.2d			Feedback: %.2d			OscKeySync: %.2d			Transpose: %.2d\n\n", voice.Algorithm, voice.Feedback, voice.OscKeySync, voice.Transpose)
+	voiceString += fmt.Sprintf("			Feedback: %.2d			OscKeySync: %s			Transpose: %s\n\n", voice.Feedback, parse.OnOff(voice.OscKeySync), parse.TransposeText(voice.Transpose))
+
+	voiceString += fmt.Sprintf("			LfoSpeed: %.2d			LfoPitchModDepth: %.2d			LfoSync: %s			LfoWave: %s\n", voice.LfoSpeed, voice.LfoPitchModDepth, parse.OnOff(voice.LfoSync), parse.LfoWaveText(voice.LfoWave))
+	voiceString += fmt.Sprintf("			LfoDelay: %.2d			LfoAMDepth: %.2d			LfoPitchModSensitivity: %.2d\n\n", voice.LfoDelay, voice.LfoAMDepth, voice.LfoPitchModSensitivity)
 
-	voiceString += fmt.Sprintf("			LfoSpeed: %.2d			LfoPitchModDepth: %.2d\n", voice.LfoSpeed, voice.LfoPitchModDepth)
-	voiceString += fmt.Sprintf("			LfoDelay: %.2d			LfoAMDepth: %.2d\n\n", voice.LfoDelay, voice.LfoAMDepth)
+	return voiceString
+
+}
+
+// starKey tells voices apart for starring, the same name can be in many banks.
+func starKey(voice parse.Voice) string {
+	return voice.BankFileName + "\x00" + voice.Name
+}
+
+// MorphSlider shows how far the morph is from the pinned voice to the selected one.
+func MorphSlider(percent int) string {
+	filled := percent / 5
+	return fmt.Sprintf(" Morph:  Reference [%s%s] Selected  %d%%\n\n", strings.Repeat("=", filled), strings.Repeat("-", 20-filled), percent)
+}
+
+// BuildCompareInfo shows the pinned reference and the selected voice side by side,
+// in the order of the voice settings, with the rows that differ highlighted.
+func BuildCompareInfo(reference parse.Voice, voice parse.Voice) string {
+
+	voiceString := fmt.Sprintf(" Reference: %v  (%v)\n", reference.Name, reference.BankFileName)
+	voiceString += fmt.Sprintf(" Selected:  %v  (%v)\n\n", voice.Name, voice.BankFileName)
 
-	voiceString += fmt.Sprintf("			LfoSync: %.2d\n", voice.LfoSync)
-	voiceString += fmt.Sprintf("			LfoWave: %.2d\n", voice.LfoWave)
-	voiceString += fmt.Sprintf("			LfoPitchModSensitivity: %.2d\n\n", voice.LfoPitchModSensitivity)
+	diffs := parse.Diff(reference, voice)
+	if len(diffs) == 0 {
+		voiceString += " The voices are identical\n\n"
+	} else {
+		voiceString += fmt.Sprintf(" [ %d ] of [ %d ] parameters differ\n\n", len(diffs), parse.ParameterCount())
+	}
+
+	differs := make(map[string]bool)
+	for _, d := range diffs {
+		differs[d.Field] = true
+	}
+
+	voiceString += fmt.Sprintf(" %s │ %s\n", addSpaces("REFERENCE", compareWidth), "SELECTED")
+
+	for _, row := range compareRows() {
+		left, right := addSpaces(row.format(reference), compareWidth), row.format(voice)
+		for _, field := range row.fields {
+			if differs[field] {
+				left, right = fmt.Sprintf("[%s](fg-red,fg-bold)", left), fmt.Sprintf("[%s](fg-red,fg-bold)", right)
+				break
+			}
+		}
+		voiceString += fmt.Sprintf(" %s │ %s\n", left, right)
+	}
 
 	return voiceString
 
 }
 
+// compareWidth is the width of each voice in the compare view.
+const compareWidth = 39
+
+// compareRow is one line of the compare view, drawn the same way for both voices,
+// and the parse.Diff fields it shows.
+type compareRow struct {
+	fields []string
+	format func(voice parse.Voice) string
+}
+
+// compareRows lays out every parameter parse.Diff compares.
+func compareRows() []compareRow {
+	rows := []compareRow{
+		{[]string{"Name"}, func(v parse.Voice) string {
+			return fmt.Sprintf("Name: %s", v.Name)
+		}},
+		{[]string{"Algorithm", "Feedback"}, func(v parse.Voice) string {
+			return fmt.Sprintf("Algorithm: %s  Feedback: %d", parse.ParameterText("Algorithm", v.Algorithm), v.Feedback)
+		}},
+		{nil, func(v parse.Voice) string { return "" }},
+	}
+
+	for op := 1; op <= 6; op++ {
+		op := op
+		field := func(names ...string) []string {
+			for i, name := range names {
+				names[i] = fmt.Sprintf("OP%d %s", op, name)
+			}
+			return names
+		}
+		operator := func(v parse.Voice) parse.Operator {
+			if len(v.Operators) != 6 {
+				return parse.Operator{}
+			}
+			return v.Operator(op)
+		}
+
+		rows = append(rows,
+			compareRow{field("OutputLevel", "OscillatorMode", "FrequencyCoarse", "FrequencyFine"), func(v parse.Voice) string {
+				o := operator(v)
+				return fmt.Sprintf("Operator %d  Out: %.2d  %s (%.2d / %.2d)", op, o.OutputLevel, o.FrequencyText(), o.FrequencyCoarse, o.FrequencyFine)
+			}},
+			compareRow{field("EGRate1", "EGRate2", "EGRate3", "EGRate4", "Detune"), func(v parse.Voice) string {
+				o := operator(v)
+				return fmt.Sprintf("  EGRate  %.2d %.2d %.2d %.2d  Detune: %s", o.EGRate1, o.EGRate2, o.EGRate3, o.EGRate4, parse.DetuneText(o.Detune))
+			}},
+			compareRow{field("EGLevel1", "EGLevel2", "EGLevel3", "EGLevel4", "KeyVelocitySensitivity", "AmplitudeModulationSensitivity"), func(v parse.Voice) string {
+				o := operator(v)
+				return fmt.Sprintf("  EGLevel %.2d %.2d %.2d %.2d  Vel: %d  AMS: %d", o.EGLevel1, o.EGLevel2, o.EGLevel3, o.EGLevel4, o.KeyVelocitySensitivity, o.AmplitudeModulationSensitivity)
+			}},
+			compareRow{field("LevelScalingBreakPoint", "ScaleLeftDepth", "ScaleLeftCurve", "ScaleRightDepth", "ScaleRightCurve", "RateScale"), func(v parse.Voice) string {
+				o := operator(v)
+				return fmt.Sprintf("  Scale %-3s L%.2d %s R%.2d %s  RS: %d", parse.BreakPointText(o.LevelScalingBreakPoint), o.ScaleLeftDepth, parse.CurveText(o.ScaleLeftCurve), o.ScaleRightDepth, parse.CurveText(o.ScaleRightCurve), o.RateScale)
+			}},
+		)
+	}
+
+	return append(rows,
+		compareRow{nil, func(v parse.Voice) string { return "" }},
+		compareRow{[]string{"PitchEGRate1", "PitchEGRate2", "PitchEGRate3", "PitchEGRate4"}, func(v parse.Voice) string {
+			return fmt.Sprintf("PitchEGRate  %.2d %.2d %.2d %.2d", v.PitchEGRate1, v.PitchEGRate2, v.PitchEGRate3, v.PitchEGRate4)
+		}},
+		compareRow{[]string{"PitchEGLevel1", "PitchEGLevel2", "PitchEGLevel3", "PitchEGLevel4"}, func(v parse.Voice) string {
+			return fmt.Sprintf("PitchEGLevel %.2d %.2d %.2d %.2d", v.PitchEGLevel1, v.PitchEGLevel2, v.PitchEGLevel3, v.PitchEGLevel4)
+		}},
+		compareRow{[]string{"OscKeySync", "Transpose"}, func(v parse.Voice) string {
+			return fmt.Sprintf("OscKeySync: %s  Transpose: %s", parse.OnOff(v.OscKeySync), parse.TransposeText(v.Transpose))
+		}},
+		compareRow{[]string{"LfoSpeed", "LfoDelay", "LfoWave"}, func(v parse.Voice) string {
+			return fmt.Sprintf("LfoSpeed: %.2d  LfoDelay: %.2d  %s", v.LfoSpeed, v.LfoDelay, parse.LfoWaveText(v.LfoWave))
+		}},
+		compareRow{[]string{"LfoPitchModDepth", "LfoAMDepth", "LfoPitchModSensitivity", "LfoSync"}, func(v parse.Voice) string {
+			return fmt.Sprintf("PMD: %.2d  AMD: %.2d  PMS: %d  Sync: %s", v.LfoPitchModDepth, v.LfoAMDepth, v.LfoPitchModSensitivity, parse.OnOff(v.LfoSync))
+		}},
+	)
+}
+
 func VoiceNames(l parse.Library) []string {
 
 	names := make([]string, 0)
@@ -370,6 +882,29 @@ func VoiceNames(l parse.Library) []string {
 
 }
 
+// color turns a color name from the config file into a termui color
+func color(name string) ui.Attribute {
+	switch strings.ToLower(name) {
+	case "black":
+		return ui.ColorBlack
+	case "red":
+		return ui.ColorRed
+	case "green":
+		return ui.ColorGreen
+	case "yellow":
+		return ui.ColorYellow
+	case "blue":
+		return ui.ColorBlue
+	case "magenta":
+		return ui.ColorMagenta
+	case "cyan":
+		return ui.ColorCyan
+	case "white":
+		return ui.ColorWhite
+	}
+	return ui.ColorDefault
+}
+
 func addSpaces(s string, w int) string {
 	if len(s) < w {
 		s += strings.Repeat(" ", w-len(s))
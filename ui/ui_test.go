@@ -0,0 +1,69 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/murdinc/MVRD_TX7_PATCHER/parse"
+)
+
+func TestCompareRowsCoverDiff(t *testing.T) {
+	shown := make(map[string]bool)
+	for _, row := range compareRows() {
+		for _, field := range row.fields {
+			shown[field] = true
+		}
+	}
+
+	if len(shown) != parse.ParameterCount() {
+		t.Errorf("the compare view shows %d parameters, parse.Diff compares %d", len(shown), parse.ParameterCount())
+	}
+
+	// Every parameter differs between these two, so every one needs a row
+	a, b := parse.InitVoice(), parse.InitVoice()
+	b.Name = "OTHER"
+	b.Algorithm, b.Feedback, b.OscKeySync, b.Transpose = 31, 7, 0, 12
+	b.PitchEGRate1, b.PitchEGRate2, b.PitchEGRate3, b.PitchEGRate4 = 1, 2, 3, 4
+	b.PitchEGLevel1, b.PitchEGLevel2, b.PitchEGLevel3, b.PitchEGLevel4 = 1, 2, 3, 4
+	b.LfoSpeed, b.LfoDelay, b.LfoPitchModDepth, b.LfoAMDepth, b.LfoSync, b.LfoWave, b.LfoPitchModSensitivity = 1, 2, 3, 4, 0, 5, 7
+	for i := range b.Operators {
+		b.Operators[i] = parse.Operator{
+			EGRate1: 1, EGRate2: 2, EGRate3: 3, EGRate4: 4, EGLevel1: 1, EGLevel2: 2, EGLevel3: 3, EGLevel4: 4,
+			LevelScalingBreakPoint: 1, ScaleLeftDepth: 1, ScaleRightDepth: 1, ScaleLeftCurve: 1, ScaleRightCurve: 1,
+			RateScale: 1, Detune: 1, AmplitudeModulationSensitivity: 1, KeyVelocitySensitivity: 1, OutputLevel: 1,
+			OscillatorMode: 1, FrequencyCoarse: 2, FrequencyFine: 1,
+		}
+	}
+	for _, d := range parse.Diff(a, b) {
+		if !shown[d.Field] {
+			t.Errorf("%s differs but has no row in the compare view", d.Field)
+		}
+	}
+}
+
+func TestBuildCompareInfo(t *testing.T) {
+	a, b := parse.InitVoice(), parse.InitVoice()
+	b.Operators[5].OutputLevel = 80
+
+	info := BuildCompareInfo(a, b)
+	if !strings.Contains(info, "[ 1 ] of [ 146 ] parameters differ") {
+		t.Errorf("compare info doesn't count the difference:\n%s", info)
+	}
+
+	// Only OP1's first row, its output level, is highlighted on both sides
+	var highlighted []string
+	for _, line := range strings.Split(info, "\n") {
+		if strings.Count(line, "(fg-red,fg-bold)") == 2 {
+			highlighted = append(highlighted, line)
+		} else if strings.Contains(line, "(fg-red") {
+			t.Errorf("only one side highlighted: %q", line)
+		}
+	}
+	if len(highlighted) != 1 || !strings.Contains(highlighted[0], "Operator 1  Out: 99") || !strings.Contains(highlighted[0], "Operator 1  Out: 80") {
+		t.Errorf("highlighted rows are %q, want OP1's output level", highlighted)
+	}
+
+	if info := BuildCompareInfo(a, a); !strings.Contains(info, "The voices are identical") || strings.Contains(info, "fg-red") {
+		t.Errorf("identical voices compare as:\n%s", info)
+	}
+}